@@ -0,0 +1,273 @@
+// Package agent runs pre-configured commands on request of authorized
+// senders, who push "run <name>" to the device of the agent.
+//
+// Only the commands of the config file can run, with their configured
+// arguments: nothing from the push reaches the command. The exit code and
+// output are pushed back as a note, with the output attached as a file when
+// large. Every request is written to an audit log.
+//
+// Usage:
+//
+//	cfg, err := agent.LoadConfig("/etc/pb-agent.json")
+//	if err != nil {
+//		log.Fatalln(err)
+//	}
+//	cli.EnsureDevice(ctx, "web01", "system", "pb agent")
+//	a := agent.New(cli, cfg)
+//	err = a.Run(ctx)
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/bot"
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+// Output kept per stream of a command; the rest is dropped.
+const maxCapture = 16 << 20
+
+var notAllowedError = errors.New("Not allowed")
+
+// Result is the outcome of a command.
+type Result struct {
+	// ExitCode of the command, -1 if it did not start or was killed.
+	ExitCode int
+	Duration time.Duration
+	Stdout   []byte
+	Stderr   []byte
+	// TimedOut reports whether the command was killed at its timeout.
+	TimedOut bool
+	// Err is the error starting or waiting for the command, nil if it
+	// exited, even with a non-zero code.
+	Err error
+}
+
+// Agent serves "run" and "list" requests pushed to its device.
+type Agent struct {
+	// Bot receiving the requests, to set its Device or Dismiss.
+	Bot *bot.Bot
+	// Audit receives a record of every request, slog.Default() if nil.
+	Audit *slog.Logger
+
+	client *client.Client
+	config *Config
+}
+
+// New returns an agent running the commands of cfg.
+func New(c *client.Client, cfg *Config) *Agent {
+	a := &Agent{Bot: bot.New(c), client: c, config: cfg}
+	// Senders are checked per command by the agent.
+	a.Bot.Handle(bot.Command{
+		Name:    "run",
+		Usage:   "name",
+		Summary: "Run a configured command",
+		MinArgs: 1,
+		MaxArgs: 1,
+		Allow:   []string{"*"},
+		Run:     a.run,
+	})
+	a.Bot.Handle(bot.Command{
+		Name:    "list",
+		Summary: "List the commands you may run",
+		Allow:   []string{"*"},
+		Run:     a.list,
+	})
+	return a
+}
+
+// Run serves requests until ctx is done, as bot.Bot.Run.
+func (a *Agent) Run(ctx context.Context) error {
+	return a.Bot.Run(ctx)
+}
+
+func (a *Agent) run(ctx context.Context, req *bot.Request) (string, error) {
+	name := req.Args[0]
+	log := a.audit().With("command", name, "sender", req.Push.SenderEmail,
+		"source_device", req.Push.SourceDeviceIden, "push", req.Push.Iden)
+	cmd, ok := a.config.Commands[name]
+	if !ok {
+		log.Warn("agent run rejected", "reason", "unknown command")
+		return "", fmt.Errorf("Unknown command %q", name)
+	}
+	if !a.allowed(ctx, cmd, req.Push) {
+		log.Warn("agent run rejected", "reason", "sender not allowed")
+		return "", notAllowedError
+	}
+
+	log.Info("agent run started", "argv", cmd.Argv)
+	res := Exec(ctx, cmd)
+	log.Info("agent run finished", "exit_code", res.ExitCode, "duration", res.Duration,
+		"timed_out", res.TimedOut, "stdout_bytes", len(res.Stdout), "stderr_bytes", len(res.Stderr), "error", res.Err)
+
+	summary := res.summary(cmd)
+	output := res.output()
+	if len(output) <= a.maxOutput() {
+		if output == "" {
+			return summary, nil
+		}
+		return summary + "\n\n" + output, nil
+	}
+	if err := a.attach(ctx, name, req.Push, output); err != nil {
+		log.Warn("agent run output not attached", "error", err)
+		return summary + "\n\n" + output[:a.maxOutput()] + "\n[truncated]", nil
+	}
+	return fmt.Sprintf("%s, output attached (%d bytes)", summary, len(output)), nil
+}
+
+func (a *Agent) list(ctx context.Context, req *bot.Request) (string, error) {
+	a.audit().Info("agent list", "sender", req.Push.SenderEmail, "source_device", req.Push.SourceDeviceIden, "push", req.Push.Iden)
+	var names []string
+	for name, cmd := range a.config.Commands {
+		if a.allowed(ctx, cmd, req.Push) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "No commands", nil
+	}
+	sort.Strings(names)
+	return strings.Join(names, "\n"), nil
+}
+
+// Reports whether the sender of push may run cmd.
+func (a *Agent) allowed(ctx context.Context, cmd CommandConfig, push client.Push) bool {
+	allow := cmd.Allow
+	if len(allow) == 0 {
+		allow = a.config.Allow
+	}
+	return a.Bot.Allowed(ctx, allow, push)
+}
+
+// Pushes output as a text file to the sender of push.
+func (a *Agent) attach(ctx context.Context, name string, push client.Push, output string) error {
+	f, err := os.CreateTemp("", "pb-agent-*.txt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(output)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fileName := fmt.Sprintf("%s-%s.txt", name, time.Now().UTC().Format("20060102T150405Z"))
+	fileUrl, err := a.client.PushFile(ctx, fileName, "text/plain", f.Name())
+	if err != nil {
+		return err
+	}
+	params := a.Bot.ReplyTo(ctx, push)
+	params["type"] = "file"
+	params["title"] = name
+	params["file_name"] = fileName
+	params["file_type"] = "text/plain"
+	params["file_url"] = fileUrl
+	// Output attached by an earlier run of the same command, as after a
+	// restart with Since in the past, is found by guid and not pushed again.
+	params["guid"] = "output-" + push.Iden
+	lookback := time.Since(client.Time(push.Created)) + time.Minute
+	_, err = a.client.CreatePush(ctx, params, client.WithGUIDLookback(lookback))
+	return err
+}
+
+func (a *Agent) maxOutput() int {
+	if a.config.MaxOutput > 0 {
+		return a.config.MaxOutput
+	}
+	return DefaultMaxOutput
+}
+
+func (a *Agent) audit() *slog.Logger {
+	if a.Audit != nil {
+		return a.Audit
+	}
+	return slog.Default()
+}
+
+// Exec runs cmd, capturing its output, until it exits or its timeout.
+func Exec(ctx context.Context, cmd CommandConfig) Result {
+	timeout := time.Duration(cmd.Timeout)
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	c := exec.CommandContext(ctx, cmd.Argv[0], cmd.Argv[1:]...)
+	c.Dir = cmd.Dir
+	c.Env = cmd.Env
+	if c.Env == nil {
+		c.Env = []string{}
+	}
+	stdout, stderr := &capture{}, &capture{}
+	c.Stdout, c.Stderr = stdout, stderr
+	// Children keeping the pipes open do not hold the agent.
+	c.WaitDelay = time.Second
+
+	start := time.Now()
+	err := c.Run()
+	res := Result{ExitCode: -1, Duration: time.Since(start), Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		res.TimedOut = true
+	case errors.As(err, &exitErr):
+		res.ExitCode = exitErr.ExitCode()
+	case err != nil:
+		res.Err = err
+	default:
+		res.ExitCode = 0
+	}
+	return res
+}
+
+// One line describing how the command ended.
+func (res Result) summary(cmd CommandConfig) string {
+	switch {
+	case res.TimedOut:
+		timeout := time.Duration(cmd.Timeout)
+		if timeout == 0 {
+			timeout = DefaultTimeout
+		}
+		return fmt.Sprintf("Timed out after %s", timeout)
+	case res.Err != nil:
+		return "Failed: " + res.Err.Error()
+	default:
+		return fmt.Sprintf("Exit %d in %s", res.ExitCode, res.Duration.Round(time.Millisecond))
+	}
+}
+
+// The output of the command as shown to the sender.
+func (res Result) output() string {
+	out := string(res.Stdout)
+	if len(res.Stderr) > 0 {
+		if out != "" && !strings.HasSuffix(out, "\n") {
+			out += "\n"
+		}
+		out += "stderr:\n" + string(res.Stderr)
+	}
+	return out
+}
+
+// Buffer keeping the first maxCapture bytes written.
+type capture struct {
+	bytes.Buffer
+}
+
+func (c *capture) Write(p []byte) (int, error) {
+	if room := maxCapture - c.Len(); room > 0 {
+		c.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
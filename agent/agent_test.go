@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+	"github.com/lucasweiblen/pushbulletclient/pbtest"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.json")
+	os.WriteFile(path, []byte(`{"commands": {"disk": {"argv": ["/bin/df", "-h"], "timeout": "30s"}}}`), 0600)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cmd := cfg.Commands["disk"]; cmd.Argv[0] != "/bin/df" || time.Duration(cmd.Timeout) != 30*time.Second {
+		t.Errorf("Unexpected command %#v", cmd)
+	}
+
+	os.Chmod(path, 0666)
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "writable") {
+		t.Errorf("Expected writable config to be refused, got %v", err)
+	}
+	os.Chmod(path, 0600)
+
+	invalid := map[string]string{
+		"relative": `{"commands": {"disk": {"argv": ["df"]}}}`,
+		"no argv":  `{"commands": {"disk": {}}}`,
+		"name":     `{"commands": {"rm -rf": {"argv": ["/bin/rm"]}}}`,
+		"timeout":  `{"commands": {"disk": {"argv": ["/bin/df"], "timeout": "soon"}}}`,
+	}
+	for name, data := range invalid {
+		os.WriteFile(path, []byte(data), 0600)
+		if _, err := LoadConfig(path); err == nil {
+			t.Errorf("Expected %s config to be refused", name)
+		}
+	}
+}
+
+func TestExec(t *testing.T) {
+	res := Exec(context.Background(), CommandConfig{Argv: []string{"/bin/sh", "-c", "echo out; echo err >&2; exit 3"}})
+	if res.ExitCode != 3 || string(res.Stdout) != "out\n" || string(res.Stderr) != "err\n" || res.Err != nil {
+		t.Errorf("Unexpected result %#v", res)
+	}
+	if out := res.output(); out != "out\nstderr:\nerr\n" {
+		t.Errorf("Unexpected output %q", out)
+	}
+	res = Exec(context.Background(), CommandConfig{Argv: []string{"/bin/sh", "-c", "echo $HOME"}})
+	if string(res.Stdout) != "\n" {
+		t.Errorf("Expected an empty environment, got %q", res.Stdout)
+	}
+	res = Exec(context.Background(), CommandConfig{Argv: []string{"/bin/sleep", "5"}, Timeout: Duration(100 * time.Millisecond)})
+	if !res.TimedOut || res.ExitCode != -1 || res.Duration > 3*time.Second {
+		t.Errorf("Expected timeout, got %#v", res)
+	}
+	res = Exec(context.Background(), CommandConfig{Argv: []string{"/nonexistent"}})
+	if res.Err == nil || res.ExitCode != -1 {
+		t.Errorf("Expected start failure, got %#v", res)
+	}
+}
+
+func TestAgent(t *testing.T) {
+	server := pbtest.NewServer()
+	defer server.Close()
+	cli := server.Client()
+	cli.DeviceFile = filepath.Join(t.TempDir(), "device.json")
+	device, err := cli.EnsureDevice(context.Background(), "web01", "system", "pb agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{
+		MaxOutput: 100,
+		Commands: map[string]CommandConfig{
+			"hello":  {Argv: []string{"/bin/echo", "hello"}},
+			"big":    {Argv: []string{"/bin/sh", "-c", "seq 1 100"}},
+			"secret": {Argv: []string{"/bin/echo", "secret"}, Allow: []string{"lead@example.com"}},
+		},
+	}
+	a := New(cli, cfg)
+	a.Bot.Since = time.Now().Add(-time.Minute)
+	var audit bytes.Buffer
+	a.Audit = slog.New(slog.NewJSONHandler(&audit, nil))
+
+	send := func(body string) client.Push {
+		return server.AddPush(client.Push{Type: "note", Active: true, Body: body, TargetDeviceIden: device.Iden,
+			SenderIden: "user", SenderEmail: "user@example.com", SourceDeviceIden: "phone"})
+	}
+	hello := send("run hello")
+	big := send("run big")
+	secret := send("run secret")
+	unknown := send("run reboot")
+	list := send("list")
+	if err := a.Bot.Sync(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	replies := map[string]client.Push{}
+	for _, push := range server.Pushes() {
+		replies[push.Guid] = push
+	}
+	if body := replies["reply-"+hello.Iden].Body; !strings.HasPrefix(body, "Exit 0 in ") || !strings.HasSuffix(body, "\n\nhello\n") {
+		t.Errorf("Unexpected reply to hello %q", body)
+	}
+	if body := replies["reply-"+big.Iden].Body; !strings.HasSuffix(body, "output attached (292 bytes)") {
+		t.Errorf("Unexpected reply to big %q", body)
+	}
+	attachment := replies["output-"+big.Iden]
+	if data, _ := server.File(attachment.FileUrl); attachment.TargetDeviceIden != "phone" || !strings.HasPrefix(string(data), "1\n2\n") {
+		t.Errorf("Expected the output attached, got %#v with %q", attachment, data)
+	}
+	if body := replies["reply-"+secret.Iden].Body; body != "Error: Not allowed" {
+		t.Errorf("Unexpected reply to secret %q", body)
+	}
+	if body := replies["reply-"+unknown.Iden].Body; body != `Error: Unknown command "reboot"` {
+		t.Errorf("Unexpected reply to reboot %q", body)
+	}
+	if body := replies["reply-"+list.Iden].Body; body != "big\nhello" {
+		t.Errorf("Unexpected reply to list %q", body)
+	}
+	pushes := len(server.Pushes())
+	if err := a.attach(context.Background(), "big", big, "1\n2\n"); err != nil || len(server.Pushes()) != pushes {
+		t.Errorf("Expected the output not to be attached twice, got %v, %d pushes instead of %d", err, len(server.Pushes()), pushes)
+	}
+	for _, want := range []string{`"msg":"agent run finished","command":"hello"`, `"reason":"sender not allowed"`, `"reason":"unknown command"`} {
+		if !strings.Contains(audit.String(), want) {
+			t.Errorf("Expected %s in audit log:\n%s", want, audit.String())
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Defaults of a Config.
+const (
+	DefaultTimeout   = time.Minute
+	DefaultMaxOutput = 4 << 10
+)
+
+// Config lists the commands an agent may run.
+//
+// Example:
+//
+//	{
+//		"allow": ["oncall@example.com"],
+//		"commands": {
+//			"restart-nginx": {"argv": ["/usr/bin/systemctl", "restart", "nginx"], "timeout": "30s"},
+//			"disk": {"argv": ["/bin/df", "-h"]}
+//		}
+//	}
+type Config struct {
+	// Allow lists the senders allowed to run the commands without their
+	// own allow-list, by email or source device iden. If empty, only
+	// pushes from the account of the client are accepted.
+	Allow []string `json:"allow"`
+	// MaxOutput is the size of the output above which it is attached as a
+	// file instead of included in the reply, DefaultMaxOutput if zero.
+	MaxOutput int `json:"max_output"`
+	// Commands by name.
+	Commands map[string]CommandConfig `json:"commands"`
+}
+
+// CommandConfig is a command an agent may run.
+type CommandConfig struct {
+	// Argv is the program, an absolute path, and its arguments. No shell
+	// is involved and nothing from the push is added.
+	Argv []string `json:"argv"`
+	// Dir is the working directory, the one of the agent if empty.
+	Dir string `json:"dir"`
+	// Env is the whole environment of the command, empty if not set.
+	Env []string `json:"env"`
+	// Timeout after which the command is killed, DefaultTimeout if zero.
+	Timeout Duration `json:"timeout"`
+	// Allow replaces Config.Allow for the command.
+	Allow []string `json:"allow"`
+}
+
+// Duration is a time.Duration written as a string in JSON, e.g. "30s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadConfig reads and validates the config file at path. The file must not
+// be writable by group or others, since it decides what the agent runs.
+func LoadConfig(path string) (*Config, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return nil, fmt.Errorf("agent: %s is writable by group or others", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("agent: reading %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks that every command has a name without spaces and an
+// absolute program path.
+func (cfg *Config) Validate() error {
+	for name, cmd := range cfg.Commands {
+		switch {
+		case name == "" || strings.ContainsFunc(name, func(r rune) bool { return r <= ' ' }):
+			return fmt.Errorf("agent: invalid command name %q", name)
+		case len(cmd.Argv) == 0:
+			return fmt.Errorf("agent: command %q has no argv", name)
+		case !filepath.IsAbs(cmd.Argv[0]):
+			return fmt.Errorf("agent: command %q: program %q is not an absolute path", name, cmd.Argv[0])
+		case cmd.Timeout < 0:
+			return fmt.Errorf("agent: command %q has a negative timeout", name)
+		}
+	}
+	return nil
+}
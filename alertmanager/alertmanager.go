@@ -0,0 +1,377 @@
+// Package alertmanager receives Alertmanager webhook notifications and
+// pushes the alerts.
+//
+// Alerts are routed by label to devices, emails, chats or channels. Every
+// route gets one push per notification, listing its alerts, rendered with
+// text/template.
+// See: https://prometheus.io/docs/alerting/latest/configuration/#webhook_config
+//
+// Usage:
+//
+//	cfg, err := alertmanager.LoadConfig("/etc/pb-alertmanager.json")
+//	if err != nil {
+//		log.Fatalln(err)
+//	}
+//	receiver, err := alertmanager.New(cli, cfg)
+//	if err != nil {
+//		log.Fatalln(err)
+//	}
+//	http.Handle("/alerts", receiver)
+package alertmanager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+// Default templates of the title and body of pushes.
+const (
+	DefaultTitle = `[{{upper .Status}}{{if .Firing}}:{{len .Firing}}{{end}}] {{or .GroupLabels.alertname .CommonLabels.alertname "alerts"}}`
+	DefaultBody  = `{{range .Alerts}}{{upper .Status}}: {{or .Annotations.summary .Labels.alertname}}
+{{with .Annotations.description}}{{.}}
+{{end}}{{range $name, $value := .Labels}}  {{$name}}={{$value}}
+{{end}}{{end}}`
+)
+
+// Largest notification accepted.
+const maxPayload = 1 << 20
+
+// DefaultRetryWindow is how long a retried notification is recognized:
+// Alertmanager stops retrying by the next group interval, 5 minutes by
+// default.
+const DefaultRetryWindow = 5 * time.Minute
+
+// Message is a webhook notification of Alertmanager.
+type Message struct {
+	Version           string            `json:"version"`
+	GroupKey          string            `json:"groupKey"`
+	TruncatedAlerts   int               `json:"truncatedAlerts"`
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []Alert           `json:"alerts"`
+}
+
+// Alert is an alert of a Message.
+type Alert struct {
+	// firing or resolved.
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// Notification is what the templates render: the message with the alerts
+// of one route.
+type Notification struct {
+	Message
+	// Route the alerts were routed to.
+	Route *Route
+	// Alerts of the route, split by status.
+	Firing   []Alert
+	Resolved []Alert
+
+	// Position of Route in the config.
+	route int
+}
+
+// Target is a recipient of the pushes of a route. Exactly one field must be
+// set.
+type Target struct {
+	// Device nickname or iden, resolved by the Resolver of the client.
+	Device  string `json:"device,omitempty"`
+	Email   string `json:"email,omitempty"`
+	Chat    string `json:"chat,omitempty"`
+	Channel string `json:"channel,omitempty"`
+}
+
+// Route sends the alerts matching its labels to its targets.
+type Route struct {
+	// Labels an alert must have, with these values.
+	Match map[string]string `json:"match,omitempty"`
+	// Labels an alert must have, matching these regular expressions.
+	MatchRE map[string]string `json:"match_re,omitempty"`
+	Targets []Target          `json:"targets"`
+	// Continue also tries the next routes for the alerts matching this
+	// one. By default an alert goes to its first matching route.
+	Continue bool `json:"continue,omitempty"`
+
+	matchRE map[string]*regexp.Regexp
+}
+
+// Config of a Receiver.
+//
+// Example:
+//
+//	{
+//		"routes": [
+//			{"match": {"severity": "critical"}, "targets": [{"device": "Pixel"}], "continue": true},
+//			{"match_re": {"team": "db|storage"}, "targets": [{"email": "dba@example.com"}]},
+//			{"targets": [{"channel": "alerts"}]}
+//		]
+//	}
+type Config struct {
+	Routes []Route `json:"routes"`
+	// Templates of the title and body of pushes, DefaultTitle and
+	// DefaultBody if empty.
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+// LoadConfig reads the config file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("alertmanager: reading %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Receiver is an http.Handler receiving webhook notifications. A
+// notification is answered with an error status, for Alertmanager to retry
+// it, if any of its pushes failed. A retry only creates the pushes that
+// failed.
+type Receiver struct {
+	// RetryWindow is how long the pushes of a notification are looked up
+	// to skip them when it is received again. A notification repeated by
+	// Alertmanager within it, with the same alerts, is not pushed again.
+	RetryWindow time.Duration
+	// OnNotify, if set, is called after the pushes of every route.
+	OnNotify func(n *Notification, results []client.PushResult, err error)
+
+	client *client.Client
+	routes []Route
+	title  *template.Template
+	body   *template.Template
+}
+
+var funcs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"join": func(sep string, s []string) string {
+		return strings.Join(s, sep)
+	},
+}
+
+// New returns a Receiver pushing with c, or an error if cfg has an invalid
+// route or template.
+func New(c *client.Client, cfg *Config) (*Receiver, error) {
+	r := &Receiver{RetryWindow: DefaultRetryWindow, client: c}
+	for i, route := range cfg.Routes {
+		if len(route.Targets) == 0 {
+			return nil, fmt.Errorf("alertmanager: route %d has no targets", i)
+		}
+		for _, target := range route.Targets {
+			if !target.valid() {
+				return nil, fmt.Errorf("alertmanager: route %d: a target needs exactly one of device, email, chat or channel", i)
+			}
+		}
+		route.matchRE = map[string]*regexp.Regexp{}
+		for label, expr := range route.MatchRE {
+			re, err := regexp.Compile("^(?:" + expr + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("alertmanager: route %d: %w", i, err)
+			}
+			route.matchRE[label] = re
+		}
+		r.routes = append(r.routes, route)
+	}
+	var err error
+	if r.title, err = parse("title", cfg.Title, DefaultTitle); err != nil {
+		return nil, err
+	}
+	if r.body, err = parse("body", cfg.Body, DefaultBody); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func parse(name, text, fallback string) (*template.Template, error) {
+	if text == "" {
+		text = fallback
+	}
+	t, err := template.New(name).Funcs(funcs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("alertmanager: %s template: %w", name, err)
+	}
+	return t, nil
+}
+
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var msg Message
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxPayload)).Decode(&msg); err != nil {
+		http.Error(w, "invalid notification: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := r.Notify(req.Context(), &msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Notify pushes the alerts of msg, one push per route and target.
+func (r *Receiver) Notify(ctx context.Context, msg *Message) error {
+	var errs []error
+	for _, n := range r.route(msg) {
+		push, err := r.render(n)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		targets := make([]client.Target, len(n.Route.Targets))
+		for i, target := range n.Route.Targets {
+			targets[i] = target.target()
+		}
+		results, err := r.client.CreatePushMulti(ctx, push, targets,
+			client.WithIdempotencyGUID(guid(n)), client.WithGUIDLookback(r.RetryWindow))
+		if r.OnNotify != nil {
+			r.OnNotify(n, results, err)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("alertmanager: %d of the pushes failed: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+// Splits the alerts of msg by route, in the order of the routes.
+func (r *Receiver) route(msg *Message) []*Notification {
+	notifications := make([]*Notification, len(r.routes))
+	for _, alert := range msg.Alerts {
+		for i := range r.routes {
+			route := &r.routes[i]
+			if !route.matches(alert) {
+				continue
+			}
+			n := notifications[i]
+			if n == nil {
+				n = &Notification{Message: *msg, Route: route, route: i}
+				n.Alerts = nil
+				notifications[i] = n
+			}
+			n.Alerts = append(n.Alerts, alert)
+			if alert.Status == "resolved" {
+				n.Resolved = append(n.Resolved, alert)
+			} else {
+				n.Firing = append(n.Firing, alert)
+			}
+			if !route.Continue {
+				break
+			}
+		}
+	}
+	var routed []*Notification
+	for _, n := range notifications {
+		if n == nil {
+			continue
+		}
+		n.Status = "resolved"
+		if len(n.Firing) > 0 {
+			n.Status = "firing"
+		}
+		routed = append(routed, n)
+	}
+	return routed
+}
+
+// Returns the guid base of the pushes of n, the same every time the
+// notification is sent: the alerts of a group, their status and the route.
+// The times of the alerts tell an alert firing again from a retry.
+func guid(n *Notification) string {
+	alerts := make([]string, len(n.Alerts))
+	for i, alert := range n.Alerts {
+		alerts[i] = alert.Fingerprint + ":" + alert.Status + ":" + alert.StartsAt.UTC().Format(time.RFC3339Nano)
+		if alert.Status == "resolved" {
+			alerts[i] += ":" + alert.EndsAt.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	sort.Strings(alerts)
+	h := sha256.New()
+	for _, field := range append([]string{n.GroupKey, n.Receiver, n.Status, strconv.Itoa(n.route)}, alerts...) {
+		h.Write([]byte(field + "\x00"))
+	}
+	return "alertmanager-" + hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// Renders the push of n: a link to Alertmanager if its URL is known, a note
+// otherwise.
+func (r *Receiver) render(n *Notification) (client.Params, error) {
+	var title, body strings.Builder
+	if err := r.title.Execute(&title, n); err != nil {
+		return nil, err
+	}
+	if err := r.body.Execute(&body, n); err != nil {
+		return nil, err
+	}
+	push := client.Params{
+		"type":  "note",
+		"title": strings.TrimSpace(title.String()),
+		"body":  strings.TrimSpace(body.String()),
+	}
+	if n.ExternalURL != "" {
+		push["type"] = "link"
+		push["url"] = n.ExternalURL
+	}
+	return push, nil
+}
+
+func (route *Route) matches(alert Alert) bool {
+	for label, value := range route.Match {
+		if alert.Labels[label] != value {
+			return false
+		}
+	}
+	for label, re := range route.matchRE {
+		if !re.MatchString(alert.Labels[label]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t Target) target() client.Target {
+	return client.Target{DeviceNickname: t.Device, Email: t.Email, Chat: t.Chat, ChannelTag: t.Channel}
+}
+
+// Reports whether exactly one field of t is set.
+func (t Target) valid() bool {
+	set := 0
+	for _, field := range []string{t.Device, t.Email, t.Chat, t.Channel} {
+		if field != "" {
+			set++
+		}
+	}
+	return set == 1
+}
@@ -0,0 +1,177 @@
+package alertmanager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+	"github.com/lucasweiblen/pushbulletclient/pbtest"
+)
+
+func newTestReceiver(t *testing.T, cfg *Config) (*httptest.Server, *pbtest.Server) {
+	server := pbtest.NewServer()
+	t.Cleanup(server.Close)
+	server.AddDevice(client.Device{Iden: "pixel", Active: true, Nickname: "Pixel"})
+	receiver, err := New(server.Client(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	web := httptest.NewServer(receiver)
+	t.Cleanup(web.Close)
+	return web, server
+}
+
+// POSTs the fixture in testdata.
+func post(t *testing.T, url, fixture string) int {
+	f, err := os.Open("testdata/" + fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	resp, err := http.Post(url, "application/json", f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+var routes = []Route{
+	{Match: map[string]string{"severity": "critical"}, Targets: []Target{{Device: "Pixel"}}, Continue: true},
+	{MatchRE: map[string]string{"team": "db|storage"}, Targets: []Target{{Email: "dba@example.com"}}},
+	{Targets: []Target{{Channel: "alerts"}}},
+}
+
+func TestReceiver(t *testing.T) {
+	web, server := newTestReceiver(t, &Config{Routes: routes})
+	if status := post(t, web.URL, "firing.json"); status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	pushes := server.Pushes()
+	if len(pushes) != 3 {
+		t.Fatalf("Expected 3 pushes, got %#v", pushes)
+	}
+	byTarget := map[string]client.Push{}
+	for _, push := range pushes {
+		byTarget[push.TargetDeviceIden+push.ReceiverEmail] = push
+	}
+	critical := byTarget["pixel"]
+	if critical.Type != "link" || critical.Url != "http://alertmanager.example.com:9093" || critical.Title != "[FIRING:1] DiskFull" {
+		t.Errorf("Unexpected push to the device %#v", critical)
+	}
+	if !strings.Contains(critical.Body, "FIRING: Disk full on db01\n/var is 98% full.\n") || !strings.Contains(critical.Body, "  instance=db01:9100") ||
+		strings.Contains(critical.Body, "web01") {
+		t.Errorf("Unexpected body %q", critical.Body)
+	}
+	if dba := byTarget["dba@example.com"]; !strings.Contains(dba.Body, "db01") || strings.Contains(dba.Body, "web01") {
+		t.Errorf("Unexpected push to the dba %#v", dba)
+	}
+	// Alerts routed to a previous route without continue stop there.
+	if channel := byTarget[""]; !strings.Contains(channel.Body, "web01") || strings.Contains(channel.Body, "db01") {
+		t.Errorf("Unexpected push to the channel %#v", channel)
+	}
+
+	if status := post(t, web.URL, "resolved.json"); status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	resolved := server.Pushes()[3]
+	if resolved.Type != "note" || resolved.Title != "[RESOLVED] DiskFull" || !strings.HasPrefix(resolved.Body, "RESOLVED: Disk full on db01") {
+		t.Errorf("Unexpected resolved push %#v", resolved)
+	}
+}
+
+func TestReceiverTemplates(t *testing.T) {
+	web, server := newTestReceiver(t, &Config{
+		Routes: []Route{{Targets: []Target{{Email: "oncall@example.com"}}}},
+		Title:  `{{.CommonLabels.job}}: {{len .Alerts}} alerts`,
+		Body:   `{{range .Firing}}{{.Labels.instance}} {{end}}`,
+	})
+	post(t, web.URL, "firing.json")
+	if pushes := server.Pushes(); len(pushes) != 1 || pushes[0].Title != "node: 2 alerts" || pushes[0].Body != "db01:9100 web01:9100" {
+		t.Errorf("Unexpected pushes %#v", pushes)
+	}
+}
+
+func TestReceiverErrors(t *testing.T) {
+	web, _ := newTestReceiver(t, &Config{Routes: []Route{{Targets: []Target{{Device: "nonexistent phone"}}}}})
+	if status := post(t, web.URL, "firing.json"); status != http.StatusBadGateway {
+		t.Errorf("Expected failed pushes to be retried, got %d", status)
+	}
+	resp, err := http.Post(web.URL, "application/json", strings.NewReader("{"))
+	if err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid payload, got %v, %v", resp, err)
+	}
+	resp, err = http.Get(web.URL)
+	if err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got %v, %v", resp, err)
+	}
+}
+
+func TestReceiverRetry(t *testing.T) {
+	server := pbtest.NewServer()
+	defer server.Close()
+	server.AddDevice(client.Device{Iden: "pixel", Active: true, Nickname: "Pixel"})
+	cli := server.Client()
+	// Devices added later are found.
+	cli.Resolver().TTL = 0
+	receiver, err := New(cli, &Config{Routes: []Route{{Targets: []Target{{Device: "Pixel"}, {Device: "Tablet"}}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	web := httptest.NewServer(receiver)
+	defer web.Close()
+	if status := post(t, web.URL, "firing.json"); status != http.StatusBadGateway {
+		t.Fatalf("Expected 502, got %d", status)
+	}
+	if pushes := server.Pushes(); len(pushes) != 1 || pushes[0].TargetDeviceIden != "pixel" {
+		t.Fatalf("Expected a push to the Pixel, got %#v", pushes)
+	}
+
+	// The retry only pushes to the device that failed.
+	server.AddDevice(client.Device{Iden: "tablet", Active: true, Nickname: "Tablet"})
+	if status := post(t, web.URL, "firing.json"); status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	pushes := server.Pushes()
+	if len(pushes) != 2 || pushes[1].TargetDeviceIden != "tablet" {
+		t.Fatalf("Expected a push to the Tablet, got %#v", pushes)
+	}
+	if status := post(t, web.URL, "firing.json"); status != http.StatusOK || len(server.Pushes()) != 2 {
+		t.Errorf("Expected no new push, got %d, %#v", status, server.Pushes())
+	}
+
+	// Another status is another notification.
+	post(t, web.URL, "resolved.json")
+	if pushes := server.Pushes(); len(pushes) != 4 {
+		t.Errorf("Expected the resolved pushes, got %#v", pushes)
+	}
+}
+
+func TestReceiverFiringAgain(t *testing.T) {
+	web, server := newTestReceiver(t, &Config{Routes: []Route{{Targets: []Target{{Email: "oncall@example.com"}}}}})
+	for _, fixture := range []string{"firing.json", "resolved.json", "refiring.json"} {
+		if status := post(t, web.URL, fixture); status != http.StatusOK {
+			t.Fatalf("Expected 200 for %s, got %d", fixture, status)
+		}
+	}
+	if pushes := server.Pushes(); len(pushes) != 3 || pushes[2].Title != "[FIRING:2] DiskFull" {
+		t.Errorf("Expected the alerts firing again to be pushed, got %#v", pushes)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	invalid := map[string]*Config{
+		"no targets": {Routes: []Route{{Match: map[string]string{"a": "b"}}}},
+		"two fields": {Routes: []Route{{Targets: []Target{{Device: "Pixel", Email: "a@example.com"}}}}},
+		"regexp":     {Routes: []Route{{MatchRE: map[string]string{"a": "("}, Targets: []Target{{Channel: "c"}}}}},
+		"template":   {Title: "{{.Status"},
+	}
+	for name, cfg := range invalid {
+		if _, err := New(nil, cfg); err == nil {
+			t.Errorf("Expected %s config to be refused", name)
+		}
+	}
+}
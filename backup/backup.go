@@ -0,0 +1,189 @@
+// Package backup exports an account to a portable archive and imports such
+// an archive into another account.
+//
+// An archive is a tar file holding a manifest.json, one JSON object per line
+// in pushes.jsonl, devices.jsonl, chats.jsonl, subscriptions.jsonl and
+// channels.jsonl, and the attachments of file pushes under
+// files/<push iden>/<file name>.
+//
+// Usage:
+//
+//	b := backup.New(cli)
+//	err := b.Export(ctx, f)
+//	report, err := backup.New(other).Import(ctx, f, backup.ImportOptions{DryRun: true})
+package backup
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+// FormatVersion is the version of the archives written by Export.
+const FormatVersion = 1
+
+var unsupportedVersionError = errors.New("backup: unsupported archive version")
+
+// Manifest describes an archive.
+type Manifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	User    string    `json:"user"`
+}
+
+// Backup exports and imports the account of a client.
+type Backup struct {
+	client *client.Client
+}
+
+// New returns a Backup for the account of c.
+func New(c *client.Client) *Backup {
+	return &Backup{client: c}
+}
+
+// Export writes an archive of the account to w. Attachments of file pushes
+// are downloaded into it.
+func (b *Backup) Export(ctx context.Context, w io.Writer) error {
+	user, err := b.client.GetMe(ctx)
+	if err != nil {
+		return err
+	}
+	pushes, err := b.client.GetPushes(ctx, client.Params{"active": true})
+	if err != nil {
+		return err
+	}
+	devices, err := b.client.GetDevices(ctx)
+	if err != nil {
+		return err
+	}
+	chats, err := b.client.GetChats(ctx)
+	if err != nil {
+		return err
+	}
+	subscriptions, err := b.client.Subscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	channels := make([]client.Channel, len(subscriptions))
+	for i, s := range subscriptions {
+		channels[i] = s.Channel
+	}
+
+	tw := tar.NewWriter(w)
+	manifest := Manifest{Version: FormatVersion, Created: time.Now().UTC(), User: user.Email}
+	if err := writeJSON(tw, "manifest.json", manifest); err != nil {
+		return err
+	}
+	if err := writeLines(tw, "pushes.jsonl", pushes); err != nil {
+		return err
+	}
+	if err := writeLines(tw, "devices.jsonl", devices); err != nil {
+		return err
+	}
+	if err := writeLines(tw, "chats.jsonl", chats); err != nil {
+		return err
+	}
+	if err := writeLines(tw, "subscriptions.jsonl", subscriptions); err != nil {
+		return err
+	}
+	if err := writeLines(tw, "channels.jsonl", channels); err != nil {
+		return err
+	}
+	for _, push := range pushes {
+		if push.Type != "file" || push.FileUrl == "" {
+			continue
+		}
+		if err := b.exportFile(ctx, tw, push); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// Downloads the attachment of push into the archive. The download goes to
+// a temporary file first since tar needs the size upfront.
+func (b *Backup) exportFile(ctx context.Context, tw *tar.Writer, push client.Push) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", push.FileUrl, nil)
+	if err != nil {
+		return err
+	}
+	httpClient := b.client.HttpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("backup: downloading %s: %s", push.FileUrl, resp.Status)
+	}
+	tmp, err := os.CreateTemp("", "pushbullet-backup-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, resp.Body)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: filePath(push), Mode: 0600, Size: size, ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, tmp)
+	return err
+}
+
+func writeJSON(tw *tar.Writer, name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(tw, name, data)
+}
+
+func writeLines[T any](tw *tar.Writer, name string, items []T) error {
+	var data []byte
+	for _, item := range items {
+		line, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	return writeFile(tw, name, data)
+}
+
+func writeFile(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// Path of the attachment of push in the archive.
+func filePath(push client.Push) string {
+	name := path.Base(strings.ReplaceAll(push.FileName, "\\", "/"))
+	if name == "." || name == "/" || name == ".." {
+		name = "file"
+	}
+	return path.Join("files", push.Iden, name)
+}
@@ -0,0 +1,80 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+	"github.com/lucasweiblen/pushbulletclient/pbtest"
+)
+
+// Returns a server with a chat, a subscription and pushes of every kind,
+// created in the order a, b, c.
+func newSourceServer(t *testing.T) *pbtest.Server {
+	server := pbtest.NewServer()
+	t.Cleanup(server.Close)
+	server.AddDevice(client.Device{Nickname: "laptop", Active: true})
+	server.AddPush(client.Push{Iden: "a", Type: "note", Title: "Groceries", Body: "Milk", Active: true})
+	server.AddPush(client.Push{Iden: "b", Type: "link", Title: "Pushbullet", Url: "http://docs.pushbullet.com", Active: true})
+	fileUrl := server.AddFile("passwd", []byte("contents of ../../etc/passwd"))
+	server.AddPush(client.Push{Iden: "c", Type: "file", FileName: "../../etc/passwd", FileType: "text/plain", FileUrl: fileUrl, Active: true})
+	server.AddChat("carmack@idsoftware.com")
+	server.AddSubscription("jblow")
+	return server
+}
+
+func TestExportImport(t *testing.T) {
+	source := newSourceServer(t)
+	var archive bytes.Buffer
+	if err := New(source.Client()).Export(context.Background(), &archive); err != nil {
+		t.Fatalf("Expected no error, got %#v", err)
+	}
+
+	target := pbtest.NewServer()
+	defer target.Close()
+	target.AddSubscription("jblow")
+	b := New(target.Client())
+	report, err := b.Import(context.Background(), bytes.NewReader(archive.Bytes()), ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %#v", err)
+	}
+	if report.Count(WouldCreate) != 4 || report.Count(Conflict) != 1 || len(target.Pushes()) != 0 || len(target.Chats()) != 0 {
+		t.Fatalf("Unexpected dry run %#v", report)
+	}
+
+	report, err = b.Import(context.Background(), bytes.NewReader(archive.Bytes()), ImportOptions{})
+	if err != nil || report.Err() != nil {
+		t.Fatalf("Expected no error, got %v %v", err, report.Err())
+	}
+	if report.Count(Created) != 4 || report.Count(Conflict) != 1 {
+		t.Errorf("Unexpected report %#v", report)
+	}
+	pushes := target.Pushes()
+	if len(pushes) != 3 || pushes[0].Title != "Groceries" || pushes[2].Type != "file" {
+		t.Fatalf("Expected pushes imported oldest first, got %#v", pushes)
+	}
+	if data, _ := target.File(pushes[2].FileUrl); string(data) != "contents of ../../etc/passwd" {
+		t.Errorf("Expected attachment to be uploaded again, got %q", data)
+	}
+	if chats := target.Chats(); len(chats) != 1 || chats[0].With.Email != "carmack@idsoftware.com" {
+		t.Errorf("Expected chat to be imported, got %#v", chats)
+	}
+
+	report, _ = b.Import(context.Background(), bytes.NewReader(archive.Bytes()), ImportOptions{})
+	if report.Count(Conflict) != 5 || len(target.Pushes()) != 3 {
+		t.Errorf("Expected second import to only report conflicts, got %#v", report)
+	}
+}
+
+func TestImportVersion(t *testing.T) {
+	var archive bytes.Buffer
+	New(newSourceServer(t).Client()).Export(context.Background(), &archive)
+	data := bytes.Replace(archive.Bytes(), []byte(`"version": 1`), []byte(`"version": 9`), 1)
+	target := pbtest.NewServer()
+	defer target.Close()
+	_, err := New(target.Client()).Import(context.Background(), bytes.NewReader(data), ImportOptions{})
+	if err != unsupportedVersionError {
+		t.Errorf("Expected unsupportedVersionError, got %#v", err)
+	}
+}
@@ -0,0 +1,311 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+// Action is the outcome of importing an item.
+type Action string
+
+const (
+	Created     Action = "created"
+	WouldCreate Action = "would create"
+	// The item already exists in the account and was skipped.
+	Conflict Action = "conflict"
+	Failed   Action = "failed"
+)
+
+// ImportOptions controls Import.
+type ImportOptions struct {
+	// DryRun reports what would be imported without changing the account.
+	DryRun bool
+}
+
+// Item is the outcome of importing one push, subscription or chat.
+type Item struct {
+	// push, subscription or chat.
+	Kind string
+	// Iden of the push in the archive, channel tag or chat email.
+	Key    string
+	Action Action
+	Err    error
+}
+
+// ImportReport lists the outcome of every item of an archive.
+type ImportReport struct {
+	Items []Item
+}
+
+// Count returns the number of items with action.
+func (r ImportReport) Count(action Action) int {
+	n := 0
+	for _, item := range r.Items {
+		if item.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// Err joins the errors of the failed items.
+func (r ImportReport) Err() error {
+	var errs []error
+	for _, item := range r.Items {
+		if item.Err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", item.Kind, item.Key, item.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Contents of an archive.
+type archive struct {
+	manifest      Manifest
+	pushes        []client.Push
+	chats         []client.Chat
+	subscriptions []client.Subscription
+	// Extracted attachments by archive path.
+	files map[string]string
+}
+
+// Import recreates the pushes, subscriptions and chats of the archive read
+// from r. Items that already exist are reported as conflicts: subscriptions
+// by channel tag, chats by email and pushes by the guid given to them on a
+// previous import. Pushes are created oldest first, without their original
+// targets, and file pushes upload their attachment again.
+func (b *Backup) Import(ctx context.Context, r io.Reader, opts ImportOptions) (ImportReport, error) {
+	dir, err := os.MkdirTemp("", "pushbullet-import-")
+	if err != nil {
+		return ImportReport{}, err
+	}
+	defer os.RemoveAll(dir)
+	a, err := readArchive(r, dir)
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	var report ImportReport
+	if err := b.importSubscriptions(ctx, a, opts, &report); err != nil {
+		return report, err
+	}
+	if err := b.importChats(ctx, a, opts, &report); err != nil {
+		return report, err
+	}
+	if err := b.importPushes(ctx, a, opts, &report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+func (b *Backup) importSubscriptions(ctx context.Context, a *archive, opts ImportOptions, report *ImportReport) error {
+	existing, err := b.client.Subscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	tags := map[string]bool{}
+	for _, s := range existing {
+		tags[s.Channel.Tag] = true
+	}
+	for _, s := range a.subscriptions {
+		item := Item{Kind: "subscription", Key: s.Channel.Tag}
+		switch {
+		case tags[s.Channel.Tag]:
+			item.Action = Conflict
+		case opts.DryRun:
+			item.Action = WouldCreate
+		default:
+			item.Action, item.Err = result(b.client.Subscribe(ctx, client.Params{"channel_tag": s.Channel.Tag}))
+		}
+		report.Items = append(report.Items, item)
+	}
+	return nil
+}
+
+func (b *Backup) importChats(ctx context.Context, a *archive, opts ImportOptions, report *ImportReport) error {
+	existing, err := b.client.GetChats(ctx)
+	if err != nil {
+		return err
+	}
+	emails := map[string]bool{}
+	for _, c := range existing {
+		emails[c.With.EmailNormalized] = true
+		emails[c.With.Email] = true
+	}
+	for _, c := range a.chats {
+		item := Item{Kind: "chat", Key: c.With.Email}
+		switch {
+		case emails[c.With.Email] || (c.With.EmailNormalized != "" && emails[c.With.EmailNormalized]):
+			item.Action = Conflict
+		case opts.DryRun:
+			item.Action = WouldCreate
+		default:
+			item.Action, item.Err = result(b.client.CreateChat(ctx, client.Params{"email": c.With.Email}))
+		}
+		report.Items = append(report.Items, item)
+	}
+	return nil
+}
+
+func (b *Backup) importPushes(ctx context.Context, a *archive, opts ImportOptions, report *ImportReport) error {
+	existing, err := b.client.GetPushes(ctx, client.Params{"active": true})
+	if err != nil {
+		return err
+	}
+	guids := map[string]bool{}
+	for _, p := range existing {
+		guids[p.Guid] = true
+	}
+	pushes := append([]client.Push(nil), a.pushes...)
+	sort.SliceStable(pushes, func(i, j int) bool {
+		return pushes[i].Created < pushes[j].Created
+	})
+	for _, p := range pushes {
+		item := Item{Kind: "push", Key: p.Iden}
+		params, err := pushParams(p, a)
+		switch {
+		case guids[importGUID(p)]:
+			item.Action = Conflict
+		case err != nil:
+			item.Action, item.Err = Failed, err
+		case opts.DryRun:
+			item.Action = WouldCreate
+		default:
+			item.Action, item.Err = b.createPush(ctx, params, a.files[filePath(p)])
+		}
+		report.Items = append(report.Items, item)
+	}
+	return nil
+}
+
+func (b *Backup) createPush(ctx context.Context, params client.Params, file string) (Action, error) {
+	if file != "" {
+		fileUrl, err := b.client.PushFile(ctx, fmt.Sprint(params["file_name"]), fmt.Sprint(params["file_type"]), file)
+		if err != nil {
+			return Failed, err
+		}
+		params["file_url"] = fileUrl
+	}
+	return result(b.client.CreatePush(ctx, params))
+}
+
+// Params recreating push, without its original targets.
+func pushParams(push client.Push, a *archive) (client.Params, error) {
+	params := client.Params{"type": push.Type, "guid": importGUID(push)}
+	if push.Title != "" {
+		params["title"] = push.Title
+	}
+	if push.Body != "" {
+		params["body"] = push.Body
+	}
+	switch push.Type {
+	case "note":
+	case "link":
+		params["url"] = push.Url
+	case "file":
+		if _, ok := a.files[filePath(push)]; !ok {
+			return nil, errors.New("attachment missing from archive")
+		}
+		params["file_name"] = push.FileName
+		params["file_type"] = push.FileType
+	default:
+		return nil, fmt.Errorf("cannot import pushes of type %q", push.Type)
+	}
+	return params, nil
+}
+
+// Guid of the push imported from push. It lets a second import of the same
+// archive detect the pushes it already created.
+func importGUID(push client.Push) string {
+	return "import-" + push.Iden
+}
+
+func result[T any](_ T, err error) (Action, error) {
+	if err != nil {
+		return Failed, err
+	}
+	return Created, nil
+}
+
+// Reads an archive, extracting attachments into dir.
+func readArchive(r io.Reader, dir string) (*archive, error) {
+	a := &archive{files: map[string]string{}}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch hdr.Name {
+		case "manifest.json":
+			if err := json.NewDecoder(tr).Decode(&a.manifest); err != nil {
+				return nil, err
+			}
+			if a.manifest.Version != FormatVersion {
+				return nil, unsupportedVersionError
+			}
+		case "pushes.jsonl":
+			err = readLines(tr, &a.pushes)
+		case "chats.jsonl":
+			err = readLines(tr, &a.chats)
+		case "subscriptions.jsonl":
+			err = readLines(tr, &a.subscriptions)
+		default:
+			if hdr.Typeflag == tar.TypeReg && path.Dir(path.Dir(hdr.Name)) == "files" {
+				err = extract(tr, hdr.Name, dir, a)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if a.manifest.Version == 0 {
+		return nil, errors.New("backup: archive has no manifest")
+	}
+	return a, nil
+}
+
+func readLines[T any](r io.Reader, items *[]T) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var item T
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			return err
+		}
+		*items = append(*items, item)
+	}
+	return scanner.Err()
+}
+
+// Extracts an attachment to a temporary file in dir. The archive path is
+// never used as a local path.
+func extract(r io.Reader, name, dir string, a *archive) error {
+	file, err := os.CreateTemp(dir, "file-")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, r); err != nil {
+		return err
+	}
+	a.files[name] = file.Name()
+	return nil
+}
@@ -0,0 +1,438 @@
+// Package bot runs commands sent as pushes, such as "status web01" from a
+// phone, and pushes their output back to the sender.
+//
+// Commands are note pushes sent to the device of the bot, detected through
+// the realtime stream with a periodic sync as a safety net. The first word
+// is the command and the rest its arguments, split as a shell would with
+// quotes. Every command has an allow-list of senders; "help" lists the
+// commands a sender may run.
+//
+// Usage:
+//
+//	cli.EnsureDevice(ctx, "ops bot", "system", "bot")
+//	b := bot.New(cli)
+//	b.Allow = []string{"oncall@example.com"}
+//	b.Handle(bot.Command{
+//		Name:    "status",
+//		Usage:   "host",
+//		Summary: "Show the status of a host",
+//		MinArgs: 1,
+//		MaxArgs: 1,
+//		Run: func(ctx context.Context, req *bot.Request) (string, error) {
+//			return status(req.Args[0])
+//		},
+//	})
+//	err := b.Run(ctx)
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+// DefaultInterval is the time between syncs when no tickle arrives.
+const DefaultInterval = 5 * time.Minute
+
+var (
+	noDeviceError          = errors.New("No device, set Device or call EnsureDevice")
+	unterminatedQuoteError = errors.New("Unterminated quote")
+)
+
+// Request is a command received by the bot.
+type Request struct {
+	// Push carrying the command.
+	Push client.Push
+	// Command name, lower case.
+	Command string
+	// Arguments following the command name.
+	Args []string
+}
+
+// Command is a command of the bot.
+type Command struct {
+	// Name the command is invoked with, matched case insensitively.
+	Name string
+	// Usage of the arguments, shown by help, e.g. "host [service]".
+	Usage string
+	// Summary shown by help.
+	Summary string
+	// Bounds of the number of arguments; MaxArgs < 0 means no limit.
+	MinArgs int
+	MaxArgs int
+	// Allow lists the senders allowed to run the command, by email or
+	// source device iden, "*" for anyone. Empty uses Bot.Allow.
+	Allow []string
+	// Run executes the command, returning the reply.
+	Run func(ctx context.Context, req *Request) (string, error)
+}
+
+// Bot runs the commands pushed to its device.
+type Bot struct {
+	// Device receiving the commands, the device of the client set up by
+	// EnsureDevice if empty.
+	Device string
+	// Allow lists the senders allowed to run commands without their own
+	// allow-list, by email or source device iden. If empty, only pushes
+	// from the account of the client are accepted.
+	Allow []string
+	// Dismiss dismisses command pushes once replied to.
+	Dismiss bool
+	// Since skips commands older than it. Zero skips the commands sent
+	// before the first sync.
+	Since time.Time
+	// Interval between syncs without tickles.
+	Interval time.Duration
+	// OnCommand, if set, is called after every reply to a command, with
+	// the reply and the error of the command or of the reply. A reply
+	// failing with a transient error is reported again when retried.
+	OnCommand func(req *Request, reply string, err error)
+
+	client   *client.Client
+	mu       sync.Mutex
+	commands map[string]Command
+	modified float64
+	// Commands run whose reply is not sent yet, oldest first.
+	pending []*outcome
+	// Iden of the user of the client, once looked up.
+	user string
+}
+
+// New returns a bot with the built-in help command.
+func New(c *client.Client) *Bot {
+	b := &Bot{Interval: DefaultInterval, client: c, commands: map[string]Command{}}
+	b.Handle(Command{
+		Name:    "help",
+		Usage:   "[command]",
+		Summary: "List the commands or show the usage of one",
+		MaxArgs: 1,
+		Run: func(ctx context.Context, req *Request) (string, error) {
+			return b.help(ctx, req), nil
+		},
+	})
+	return b
+}
+
+// Handle adds cmd, replacing any command with the same name.
+func (b *Bot) Handle(cmd Command) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.commands[strings.ToLower(cmd.Name)] = cmd
+}
+
+// Run syncs on every push tickle of the realtime stream and every Interval,
+// until ctx is done. Failed syncs are retried at the next occasion; Run only
+// returns early if the API rejects the access token.
+func (b *Bot) Run(ctx context.Context) error {
+	if b.device() == "" {
+		return noDeviceError
+	}
+	return b.client.SyncOnTickles(ctx, b.Interval, b.Sync)
+}
+
+// Sync handles the commands that arrived since the last sync, oldest first.
+// A command is run once: if its reply fails with a transient error, which is
+// returned, only the reply is sent again by the next sync.
+func (b *Bot) Sync(ctx context.Context) error {
+	device := b.device()
+	if device == "" {
+		return noDeviceError
+	}
+	b.mu.Lock()
+	if b.modified == 0 {
+		since := b.Since
+		if since.IsZero() {
+			since = time.Now()
+		}
+		b.modified = client.Timestamp(since)
+	}
+	params := client.Params{"modified_after": b.modified}
+	pending := b.pending
+	b.mu.Unlock()
+
+	for len(pending) > 0 {
+		// The failed attempt may have created the reply.
+		lookback := client.WithGUIDLookback(time.Since(pending[0].sent) + time.Minute)
+		if err := b.send(ctx, pending[0], lookback); err != nil && !client.IsPermanent(err) {
+			return err
+		}
+		pending = b.sent()
+	}
+	pushes, err := b.client.GetPushes(ctx, params)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(pushes, func(i, j int) bool {
+		return pushes[i].Modified < pushes[j].Modified
+	})
+	for _, push := range pushes {
+		var cmd *outcome
+		if push.Active && !push.Dismissed && push.Type == "note" && push.TargetDeviceIden == device {
+			cmd = b.run(ctx, push)
+		}
+		b.mu.Lock()
+		if push.Modified > b.modified {
+			b.modified = push.Modified
+		}
+		if cmd != nil {
+			b.pending = append(b.pending, cmd)
+		}
+		b.mu.Unlock()
+		if cmd != nil {
+			if err := b.send(ctx, cmd); err != nil && !client.IsPermanent(err) {
+				return err
+			}
+			b.sent()
+		}
+	}
+	return nil
+}
+
+// outcome is a command run, with its reply.
+type outcome struct {
+	req   *Request
+	reply string
+	// Error of the command.
+	err error
+	// Time of the first attempt to reply.
+	sent time.Time
+}
+
+// Runs the command of push, nil if push holds none.
+func (b *Bot) run(ctx context.Context, push client.Push) *outcome {
+	line := strings.TrimSpace(push.Body)
+	if line == "" {
+		line = strings.TrimSpace(push.Title)
+	}
+	args, err := Split(line)
+	if len(args) == 0 && err == nil {
+		return nil
+	}
+	req := &Request{Push: push}
+	if len(args) > 0 {
+		req.Command, req.Args = strings.ToLower(args[0]), args[1:]
+	}
+
+	b.mu.Lock()
+	cmd, ok := b.commands[req.Command]
+	b.mu.Unlock()
+	var reply string
+	switch {
+	case err != nil:
+		reply = err.Error()
+	case !ok:
+		reply = fmt.Sprintf("Unknown command %q, send \"help\" for the list of commands", req.Command)
+	case !b.allowed(ctx, cmd, push):
+		reply = "Not allowed"
+	case len(req.Args) < cmd.MinArgs || (cmd.MaxArgs >= 0 && len(req.Args) > cmd.MaxArgs):
+		reply = "Usage: " + usage(cmd)
+	default:
+		reply, err = cmd.Run(ctx, req)
+		if err != nil {
+			reply = "Error: " + err.Error()
+		}
+	}
+	return &outcome{req: req, reply: reply, err: err, sent: time.Now()}
+}
+
+// Replies to the sender of the command of cmd.
+func (b *Bot) send(ctx context.Context, cmd *outcome, opts ...client.RequestOption) error {
+	push := cmd.req.Push
+	replyErr := b.reply(ctx, push, cmd.req.Command, cmd.reply, opts...)
+	if replyErr == nil && b.Dismiss {
+		// Dismissal failures are not worth replying again.
+		b.client.UpdatePush(ctx, client.Params{"iden": push.Iden, "dismissed": true})
+	}
+	if b.OnCommand != nil {
+		err := cmd.err
+		if replyErr != nil {
+			err = replyErr
+		}
+		b.OnCommand(cmd.req, cmd.reply, err)
+	}
+	return replyErr
+}
+
+// Drops the oldest pending reply, once sent, and returns the others.
+func (b *Bot) sent() []*outcome {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = b.pending[1:]
+	return b.pending
+}
+
+// Pushes reply back to the device or the user that sent push.
+func (b *Bot) reply(ctx context.Context, push client.Push, command, reply string, opts ...client.RequestOption) error {
+	params := b.ReplyTo(ctx, push)
+	params["type"] = "note"
+	params["title"] = command
+	params["body"] = reply
+	// A retried reply, looked up by guid, is not pushed twice.
+	params["guid"] = "reply-" + push.Iden
+	_, err := b.client.CreatePush(ctx, params, opts...)
+	return err
+}
+
+// ReplyTo returns the params of a push back to the sender of push, for
+// commands pushing more than their reply: to the device push was sent from
+// if sent by the account of the client, to the email of the sender
+// otherwise.
+func (b *Bot) ReplyTo(ctx context.Context, push client.Push) client.Params {
+	params := client.Params{"source_device_iden": b.device()}
+	switch {
+	case b.own(ctx, push) && push.SourceDeviceIden != "":
+		params["device_iden"] = push.SourceDeviceIden
+	case push.SenderEmail != "":
+		params["email"] = push.SenderEmail
+	}
+	return params
+}
+
+// Reports whether the sender of push may run cmd.
+func (b *Bot) allowed(ctx context.Context, cmd Command, push client.Push) bool {
+	allow := cmd.Allow
+	if len(allow) == 0 {
+		allow = b.Allow
+	}
+	return b.Allowed(ctx, allow, push)
+}
+
+// Allowed reports whether the sender of push is in allow, by email or
+// source device iden, or allow contains "*". An empty allow-list only
+// accepts the account of the client.
+func (b *Bot) Allowed(ctx context.Context, allow []string, push client.Push) bool {
+	if len(allow) == 0 {
+		return b.own(ctx, push)
+	}
+	for _, sender := range allow {
+		if sender == "*" || strings.EqualFold(sender, push.SenderEmail) || strings.EqualFold(sender, push.SenderEmailNormalized) ||
+			(push.SourceDeviceIden != "" && sender == push.SourceDeviceIden) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether push was sent by the account of the client.
+func (b *Bot) own(ctx context.Context, push client.Push) bool {
+	return push.SenderIden != "" && push.SenderIden == b.userIden(ctx)
+}
+
+// Returns the iden of the user of the client, looked up on first use and
+// again after a failure, "" if unknown.
+func (b *Bot) userIden(ctx context.Context) string {
+	b.mu.Lock()
+	user := b.user
+	b.mu.Unlock()
+	if user != "" {
+		return user
+	}
+	me, err := b.client.GetMe(ctx)
+	if err != nil {
+		return ""
+	}
+	b.mu.Lock()
+	b.user = me.Iden
+	b.mu.Unlock()
+	return me.Iden
+}
+
+// Returns the help text for req, listing the commands the sender may run.
+func (b *Bot) help(ctx context.Context, req *Request) string {
+	b.mu.Lock()
+	var commands []Command
+	for _, cmd := range b.commands {
+		commands = append(commands, cmd)
+	}
+	b.mu.Unlock()
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Name < commands[j].Name
+	})
+
+	var lines []string
+	for _, cmd := range commands {
+		if !b.allowed(ctx, cmd, req.Push) {
+			continue
+		}
+		if len(req.Args) == 1 && !strings.EqualFold(req.Args[0], cmd.Name) {
+			continue
+		}
+		line := usage(cmd)
+		if cmd.Summary != "" {
+			line += " - " + cmd.Summary
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return "No commands"
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (b *Bot) device() string {
+	if b.Device != "" {
+		return b.Device
+	}
+	return b.client.DeviceIden()
+}
+
+func usage(cmd Command) string {
+	if cmd.Usage == "" {
+		return cmd.Name
+	}
+	return cmd.Name + " " + cmd.Usage
+}
+
+// Split splits line into words separated by spaces. Single or double quotes
+// group words, and a backslash escapes the next character.
+//
+// Usage:
+//
+//	args, err := bot.Split(`deploy web01 "release 42"`)
+func Split(line string) ([]string, error) {
+	var (
+		args    []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote, inWord = r, true
+		case unicode.IsSpace(r):
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, unterminatedQuoteError
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
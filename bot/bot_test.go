@@ -0,0 +1,269 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+	"github.com/lucasweiblen/pushbulletclient/pbtest"
+)
+
+func newTestBot(t *testing.T) (*Bot, *pbtest.Server) {
+	server := pbtest.NewServer()
+	t.Cleanup(server.Close)
+	cli := server.Client()
+	cli.DeviceFile = filepath.Join(t.TempDir(), "device.json")
+	if _, err := cli.EnsureDevice(context.Background(), "ops bot", "system", "bot"); err != nil {
+		t.Fatal(err)
+	}
+	b := New(cli)
+	b.Since = time.Now().Add(-time.Minute)
+	b.Handle(Command{
+		Name: "status", Usage: "host", Summary: "Show the status of a host", MinArgs: 1, MaxArgs: 1,
+		Run: func(ctx context.Context, req *Request) (string, error) {
+			if req.Args[0] == "down01" {
+				return "", errors.New("unreachable")
+			}
+			return req.Args[0] + " is up", nil
+		},
+	})
+	b.Handle(Command{
+		Name: "deploy", Usage: "service...", MinArgs: 1, MaxArgs: -1, Allow: []string{"lead@example.com"},
+		Run: func(ctx context.Context, req *Request) (string, error) {
+			return "deployed " + strings.Join(req.Args, ", "), nil
+		},
+	})
+	return b, server
+}
+
+// Returns the body of the reply to the command with iden.
+func reply(server *pbtest.Server, iden string) string {
+	for _, push := range server.Pushes() {
+		if push.Guid == "reply-"+iden {
+			return push.Body
+		}
+	}
+	return ""
+}
+
+// Counts the API calls by operation.
+type observer struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (o *observer) Start(ctx context.Context, operation string) (context.Context, func(client.Call)) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.calls == nil {
+		o.calls = map[string]int{}
+	}
+	o.calls[operation]++
+	return ctx, func(client.Call) {}
+}
+
+func (o *observer) count(operation string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.calls[operation]
+}
+
+func TestSync(t *testing.T) {
+	b, server := newTestBot(t)
+	calls := &observer{}
+	b.client.Observer = calls
+	b.Dismiss = true
+	device := b.device()
+	own := func(body string) client.Push {
+		return server.AddPush(client.Push{Type: "note", Active: true, Body: body, TargetDeviceIden: device,
+			SenderIden: "user", SenderEmail: "user@example.com", SourceDeviceIden: "phone"})
+	}
+	status := own("Status web01")
+	failing := own("status down01")
+	usage := own("status")
+	unknown := own("reboot web01")
+	quote := own(`status "web01`)
+	denied := own("deploy web")
+	other := server.AddPush(client.Push{Type: "note", Active: true, Body: "status web01", TargetDeviceIden: "phone"})
+	stranger := server.AddPush(client.Push{Type: "note", Active: true, Body: "status web01", TargetDeviceIden: device,
+		SenderIden: "stranger", SenderEmail: "stranger@example.com"})
+	lead := server.AddPush(client.Push{Type: "note", Active: true, Body: "deploy web api", TargetDeviceIden: device,
+		SenderIden: "lead", SenderEmail: "lead@example.com"})
+
+	if err := b.Sync(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	tests := map[string]string{
+		status.Iden:   "web01 is up",
+		failing.Iden:  "Error: unreachable",
+		usage.Iden:    "Usage: status host",
+		unknown.Iden:  `Unknown command "reboot", send "help" for the list of commands`,
+		quote.Iden:    "Unterminated quote",
+		denied.Iden:   "Not allowed",
+		other.Iden:    "",
+		stranger.Iden: "Not allowed",
+		lead.Iden:     "deployed web, api",
+	}
+	for iden, want := range tests {
+		if got := reply(server, iden); got != want {
+			t.Errorf("Expected reply %q to %s, got %q", want, iden, got)
+		}
+	}
+	for _, push := range server.Pushes() {
+		switch push.Guid {
+		case "reply-" + status.Iden:
+			if push.TargetDeviceIden != "phone" || push.SourceDeviceIden != device {
+				t.Errorf("Expected reply to the phone, got %#v", push)
+			}
+		case "reply-" + lead.Iden:
+			if push.ReceiverEmail != "lead@example.com" {
+				t.Errorf("Expected reply to lead@example.com, got %#v", push)
+			}
+		case "":
+			if push.TargetDeviceIden == device && push.Iden != other.Iden && !push.Dismissed {
+				t.Errorf("Expected %s to be dismissed", push.Iden)
+			}
+		}
+	}
+
+	if calls.count("GetMe") != 1 {
+		t.Errorf("Expected the user to be looked up once, got %d calls", calls.count("GetMe"))
+	}
+
+	// Handled commands are not run again.
+	replies := len(server.Pushes())
+	b.Sync(context.Background())
+	if len(server.Pushes()) != replies {
+		t.Errorf("Expected no new replies, got %d pushes instead of %d", len(server.Pushes()), replies)
+	}
+}
+
+// Fails the next push created with a server error.
+type failingPush struct {
+	fail bool
+	// The failed push reaches the server all the same.
+	lost bool
+}
+
+func (f *failingPush) RoundTrip(r *http.Request) (*http.Response, error) {
+	if f.fail && r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/pushes") {
+		f.fail = false
+		if f.lost {
+			resp, err := http.DefaultTransport.RoundTrip(r)
+			if err != nil {
+				return nil, err
+			}
+			resp.Body.Close()
+		}
+		return &http.Response{StatusCode: http.StatusInternalServerError, Body: io.NopCloser(strings.NewReader("{}")),
+			Header: http.Header{}, Request: r}, nil
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestSyncReplyFailure(t *testing.T) {
+	b, server := newTestBot(t)
+	transport := &failingPush{}
+	b.client.HttpClient = &http.Client{Transport: transport}
+	b.client.MaxRetries = 0
+	runs := 0
+	b.Handle(Command{Name: "restart", Run: func(ctx context.Context, req *Request) (string, error) {
+		runs++
+		return "restarted", nil
+	}})
+	push := server.AddPush(client.Push{Type: "note", Active: true, Body: "restart", TargetDeviceIden: b.device(), SenderIden: "user"})
+
+	transport.fail = true
+	if err := b.Sync(context.Background()); err == nil {
+		t.Fatal("Expected the reply to fail")
+	}
+	if err := b.Sync(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if runs != 1 || reply(server, push.Iden) != "restarted" {
+		t.Errorf("Expected the command run once and replied to, got %d runs, reply %q", runs, reply(server, push.Iden))
+	}
+
+	// A reply created despite the error is not pushed again.
+	push = server.AddPush(client.Push{Type: "note", Active: true, Body: "restart", TargetDeviceIden: b.device(), SenderIden: "user"})
+	transport.fail, transport.lost = true, true
+	if err := b.Sync(context.Background()); err == nil {
+		t.Fatal("Expected the reply to fail")
+	}
+	if err := b.Sync(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	replies := 0
+	for _, p := range server.Pushes() {
+		if p.Guid == "reply-"+push.Iden {
+			replies++
+		}
+	}
+	if replies != 1 {
+		t.Errorf("Expected one reply, got %d", replies)
+	}
+}
+
+func TestHelp(t *testing.T) {
+	b, _ := newTestBot(t)
+	ctx := context.Background()
+	req := &Request{Push: client.Push{SenderIden: "user"}}
+	want := "help [command] - List the commands or show the usage of one\nstatus host - Show the status of a host"
+	if got := b.help(ctx, req); got != want {
+		t.Errorf("Expected help %q, got %q", want, got)
+	}
+	req = &Request{Push: client.Push{SenderEmail: "lead@example.com"}, Args: []string{"deploy"}}
+	if got := b.help(ctx, req); got != "deploy service..." {
+		t.Errorf("Expected deploy help, got %q", got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	b, server := newTestBot(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan string, 1)
+	b.OnCommand = func(req *Request, reply string, err error) {
+		done <- reply
+	}
+	go b.Run(ctx)
+	if !server.WaitStreams(1, 5*time.Second) {
+		t.Fatal("Expected the bot to connect")
+	}
+	server.AddPush(client.Push{Type: "note", Active: true, Body: "status web01", TargetDeviceIden: b.device(), SenderIden: "user"})
+	select {
+	case reply := <-done:
+		if reply != "web01 is up" {
+			t.Errorf("Unexpected reply %q", reply)
+		}
+	case <-ctx.Done():
+		t.Fatal("Expected the command to run on the tickle")
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := map[string][]string{
+		`status web01`:              {"status", "web01"},
+		`  deploy  "release 42" x `: {"deploy", "release 42", "x"},
+		`say 'it''s' a\ b`:          {"say", "its", "a b"},
+		`empty ""`:                  {"empty", ""},
+		``:                          nil,
+	}
+	for line, want := range tests {
+		got, err := Split(line)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("Split(%q): expected %q, got %q, %v", line, want, got, err)
+		}
+	}
+	if _, err := Split(`say "hello`); err != unterminatedQuoteError {
+		t.Errorf("Expected unterminatedQuoteError, got %v", err)
+	}
+}
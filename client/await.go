@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// DefaultAwaitTimeout bounds SendAndAwait when ctx has no deadline.
+const DefaultAwaitTimeout = 30 * time.Second
+
+var pushNotSeenError = errors.New("Push did not appear on the stream")
+
+// Create a push and wait for it to show up on the realtime event stream.
+// See: https://docs.pushbullet.com/#realtime-event-stream
+//
+// Usage:
+//
+//	push, err := client.SendAndAwait(ctx, client.Params{"type": "note", "body": "backup done"}, client.WithTimeout(time.Minute))
+//
+// The stream is connected before the push is created. Every push tickle,
+// and every reconnection, syncs the recent pushes until one has the guid of
+// the push, which is taken as created as with CreatePush. The call is
+// bounded by ctx, WithTimeout or DefaultAwaitTimeout; if the push was
+// created but not seen in time, it is returned with an error.
+func (c *Client) SendAndAwait(ctx context.Context, push Params, opts ...RequestOption) (Push, error) {
+	ctx, cancel := withRequestOptions(ctx, opts)
+	defer cancel()
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultAwaitTimeout)
+		defer cancel()
+	}
+
+	streamCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	// Signals a connection or a push tickle; one pending signal is enough.
+	wake := make(chan struct{}, 1)
+	signal := func() {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	streamErr := make(chan error, 1)
+	go func() {
+		streamErr <- c.listen(streamCtx, func(msg StreamMessage) {
+			if msg.Type == "tickle" && msg.Subtype == "push" {
+				signal()
+			}
+		}, signal)
+	}()
+
+	wait := func() error {
+		select {
+		case <-wake:
+			return nil
+		case err := <-streamErr:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := wait(); err != nil {
+		return Push{}, err
+	}
+
+	// The guid is settled here, CreatePush leaving push untouched.
+	push = copyParams(push)
+	guid := requestConfigFrom(ctx).guid
+	if guid == "" {
+		guid, _ = push["guid"].(string)
+	}
+	if guid == "" {
+		guid = NewGUID()
+	}
+	push["guid"] = guid
+	since := time.Now().Add(-guidLookback)
+	created, err := c.CreatePush(ctx, push)
+	if err != nil {
+		return Push{}, err
+	}
+	for {
+		if err := wait(); err == context.DeadlineExceeded {
+			return created, pushNotSeenError
+		} else if err != nil {
+			return created, err
+		}
+		if found, ok := c.findPush(ctx, guid, since); ok {
+			return found, nil
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePushes stores created pushes and announces them on the stream with a
+// push tickle, if tickle is set.
+type fakePushes struct {
+	mu       sync.Mutex
+	pushes   []Push
+	messages chan string
+	tickle   bool
+}
+
+func (f *fakePushes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Method == "GET" {
+		json.NewEncoder(w).Encode(Pushes{Pushes: f.pushes})
+		return
+	}
+	var params Params
+	json.NewDecoder(r.Body).Decode(&params)
+	push := Push{Iden: "p1", Active: true, Type: params["type"].(string), Guid: params["guid"].(string)}
+	f.pushes = append(f.pushes, push)
+	if f.tickle {
+		f.messages <- `{"type": "tickle", "subtype": "push"}`
+	}
+	json.NewEncoder(w).Encode(push)
+}
+
+func newAwaitClient(t *testing.T, fake *fakePushes) *Client {
+	fake.messages = make(chan string, 4)
+	server := newStreamServer(t, fake.messages)
+	client := newTestClient(&handlerRoundTripper{handler: fake})
+	client.StreamURL = "ws" + strings.TrimPrefix(server.URL, "http") + "/websocket/"
+	return client
+}
+
+func TestSendAndAwait(t *testing.T) {
+	fake := &fakePushes{tickle: true}
+	client := newAwaitClient(t, fake)
+	push, err := client.SendAndAwait(context.Background(), Params{"type": "note", "guid": "0xguid"}, WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if push.Iden != "p1" || push.Guid != "0xguid" {
+		t.Errorf("Unexpected push %#v", push)
+	}
+}
+
+func TestSendAndAwaitTimeout(t *testing.T) {
+	fake := &fakePushes{}
+	client := newAwaitClient(t, fake)
+	push, err := client.SendAndAwait(context.Background(), Params{"type": "note"}, WithTimeout(500*time.Millisecond))
+	if err != pushNotSeenError {
+		t.Errorf("Expected pushNotSeenError, got %v", err)
+	}
+	if push.Iden != "p1" {
+		t.Errorf("Expected the created push, got %#v", push)
+	}
+}
+
+func TestSendAndAwaitUnauthorized(t *testing.T) {
+	fake := &fakePushes{}
+	client := newAwaitClient(t, fake)
+	client.token = "invalid"
+	_, err := client.SendAndAwait(context.Background(), Params{"type": "note"})
+	httpErr, ok := err.(*HttpError)
+	if !ok || httpErr.Status != http.StatusUnauthorized {
+		t.Errorf("Expected unauthorized error, got %v", err)
+	}
+	if len(fake.pushes) != 0 {
+		t.Errorf("Expected no push to be created, got %d", len(fake.pushes))
+	}
+}
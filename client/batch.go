@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Default number of workers of a batch.
+const DefaultBatchWorkers = 4
+
+// Op is one operation of a batch.
+type Op struct {
+	// Key identifies the operation in the report, e.g. a push iden.
+	Key string
+	Run func(ctx context.Context, c *Client) error
+}
+
+// BatchOptions controls Batch.
+type BatchOptions struct {
+	// Workers is the number of operations run concurrently,
+	// DefaultBatchWorkers if zero.
+	Workers int
+	// MinRemaining pauses the batch until the rate limit resets whenever
+	// fewer requests than this are left. The batch always pauses once none
+	// is left.
+	MinRemaining int
+}
+
+// BatchResult is the outcome of an operation. Err is the context error
+// for operations not run because the batch was cancelled.
+type BatchResult struct {
+	Key string
+	Err error
+}
+
+// BatchReport lists the outcome of every operation, in order.
+type BatchReport struct {
+	Results []BatchResult
+}
+
+// Failed returns the results of the operations that failed.
+func (r BatchReport) Failed() []BatchResult {
+	var failed []BatchResult
+	for _, result := range r.Results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Err joins the errors of the failed operations.
+func (r BatchReport) Err() error {
+	var errs []error
+	for _, result := range r.Failed() {
+		errs = append(errs, fmt.Errorf("%s: %w", result.Key, result.Err))
+	}
+	return errors.Join(errs...)
+}
+
+// Run many operations concurrently. Unlike a loop, a failed operation does
+// not stop the others. The error is the joined error of the report.
+//
+// Usage:
+//
+//	ops := []client.Op{client.DeletePushOp("0xyz"), client.DismissPushOp("0xabc")}
+//	report, err := client.Batch(ctx, ops, client.BatchOptions{Workers: 8})
+func (c *Client) Batch(ctx context.Context, ops []Op, opts BatchOptions) (BatchReport, error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = DefaultBatchWorkers
+	}
+	minRemaining := max(opts.MinRemaining, 1)
+	report := BatchReport{Results: make([]BatchResult, len(ops))}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				err := c.WaitRateLimit(ctx, minRemaining)
+				if err == nil {
+					err = ops[i].Run(ctx, c)
+				}
+				report.Results[i] = BatchResult{Key: ops[i].Key, Err: err}
+			}
+		}()
+	}
+	next := 0
+dispatch:
+	for ; next < len(ops); next++ {
+		select {
+		case jobs <- next:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	for i := next; i < len(ops); i++ {
+		report.Results[i] = BatchResult{Key: ops[i].Key, Err: ctx.Err()}
+	}
+	return report, report.Err()
+}
+
+// DeletePushOp deletes the push with iden.
+func DeletePushOp(iden string) Op {
+	return Op{Key: iden, Run: func(ctx context.Context, c *Client) error {
+		return c.DeletePush(ctx, Params{"iden": iden})
+	}}
+}
+
+// DismissPushOp dismisses the push with iden.
+func DismissPushOp(iden string) Op {
+	return UpdatePushOp(iden, Params{"dismissed": true})
+}
+
+// UpdatePushOp updates the push with iden, e.g. to re-target it.
+func UpdatePushOp(iden string, params Params) Op {
+	return Op{Key: iden, Run: func(ctx context.Context, c *Client) error {
+		p := Params{"iden": iden}
+		for k, v := range params {
+			p[k] = v
+		}
+		_, err := c.UpdatePush(ctx, p)
+		return err
+	}}
+}
+
+// DeleteDeviceOp deletes the device with iden.
+func DeleteDeviceOp(iden string) Op {
+	return Op{Key: iden, Run: func(ctx context.Context, c *Client) error {
+		return c.DeleteDevice(ctx, Params{"iden": iden})
+	}}
+}
+
+// UpdateDeviceOp updates the device with iden.
+func UpdateDeviceOp(iden string, params Params) Op {
+	return Op{Key: iden, Run: func(ctx context.Context, c *Client) error {
+		p := Params{"iden": iden}
+		for k, v := range params {
+			p[k] = v
+		}
+		_, err := c.UpdateDevice(ctx, p)
+		return err
+	}}
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBatch(t *testing.T) {
+	var mu sync.Mutex
+	var running, maxRunning int32
+	deleted := map[string]bool{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		mu.Lock()
+		if n > maxRunning {
+			maxRunning = n
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		iden := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		if iden == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"type": "invalid_request", "message": "Object not found"}}`))
+			return
+		}
+		mu.Lock()
+		deleted[iden] = true
+		mu.Unlock()
+		w.Write([]byte("{}"))
+	})
+	client := newTestClient(roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return (&handlerRoundTripper{handler: handler}).RoundTrip(r)
+	}))
+
+	ops := []Op{DeletePushOp("a"), DeletePushOp("missing"), DeletePushOp("b"), DeletePushOp("c"), DeletePushOp("d")}
+	report, err := client.Batch(context.Background(), ops, BatchOptions{Workers: 2})
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Expected error for missing push, got %v", err)
+	}
+	if len(report.Results) != len(ops) {
+		t.Fatalf("Expected %d results, got %d", len(ops), len(report.Results))
+	}
+	for i, result := range report.Results {
+		if result.Key != ops[i].Key {
+			t.Errorf("Expected result %d for %s, got %s", i, ops[i].Key, result.Key)
+		}
+	}
+	var httpErr *HttpError
+	failed := report.Failed()
+	if len(failed) != 1 || !errors.As(failed[0].Err, &httpErr) || httpErr.Status != http.StatusNotFound {
+		t.Errorf("Expected one not found error, got %#v", failed)
+	}
+	if len(deleted) != 4 {
+		t.Errorf("Expected 4 deleted pushes, got %v", deleted)
+	}
+	if maxRunning > 2 {
+		t.Errorf("Expected at most 2 concurrent requests, got %d", maxRunning)
+	}
+}
+
+func TestBatchCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client := newTestClient(&FakeRoundTripper{message: "{}", status: http.StatusOK})
+	report, err := client.Batch(ctx, []Op{DismissPushOp("a"), DismissPushOp("b")}, BatchOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	for _, result := range report.Results {
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("Expected %s to be cancelled, got %v", result.Key, result.Err)
+		}
+	}
+}
+
+func TestBatchRateLimit(t *testing.T) {
+	client := newTestClient(&FakeRoundTripper{message: "{}", status: http.StatusOK})
+	client.rateLimit = RateLimit{Limit: 100, Remaining: 0, Reset: time.Now().Add(100 * time.Millisecond)}
+	start := time.Now()
+	if _, err := client.Batch(context.Background(), []Op{DismissPushOp("a")}, BatchOptions{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("Expected the batch to wait for the reset without quota left, took %v", elapsed)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,169 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default TTLs of a Cache.
+const (
+	DefaultMeTTL       = 5 * time.Minute
+	DefaultDevicesTTL  = time.Minute
+	DefaultChannelsTTL = 10 * time.Minute
+)
+
+// Cache keeps the results of GetMe, GetDevices and GetChannel in memory.
+// Concurrent identical requests are coalesced into one, whether or not the
+// result is then cached. Calls changing the user or devices invalidate the
+// cached entries, and so does a running Stream on tickles.
+//
+// Usage:
+//
+//	client.Cache = client.NewCache()
+//	client.Cache.DevicesTTL = 10 * time.Second
+type Cache struct {
+	// TTLs of the resources. A zero TTL disables caching of the resource.
+	MeTTL       time.Duration
+	DevicesTTL  time.Duration
+	ChannelsTTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	calls   map[string]*cacheCall
+	// Incremented by every invalidation, so that results of requests
+	// started before it are not cached.
+	generation int
+}
+
+type cacheEntry struct {
+	value   any
+	expires time.Time
+}
+
+// A request other callers wait for.
+type cacheCall struct {
+	done  chan struct{}
+	value any
+	err   error
+}
+
+// NewCache returns a Cache with the default TTLs.
+func NewCache() *Cache {
+	return &Cache{MeTTL: DefaultMeTTL, DevicesTTL: DefaultDevicesTTL, ChannelsTTL: DefaultChannelsTTL}
+}
+
+// Invalidate drops the cached entries of resources, which are "me",
+// "devices" or "channels". Without resources, all entries are dropped.
+func (c *Cache) Invalidate(resources ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	if len(resources) == 0 {
+		c.entries = nil
+		return
+	}
+	for key := range c.entries {
+		for _, resource := range resources {
+			if key == resource || strings.HasPrefix(key, resource+"/") {
+				delete(c.entries, key)
+			}
+		}
+	}
+}
+
+func (c *Cache) ttl(key string) time.Duration {
+	switch resource, _, _ := strings.Cut(key, "/"); resource {
+	case "me":
+		return c.MeTTL
+	case "devices":
+		return c.DevicesTTL
+	case "channels":
+		return c.ChannelsTTL
+	}
+	return 0
+}
+
+// Returns the cached value of key, or the result of fetch. Only one fetch of
+// a key runs at a time; other callers wait for its result, and fetch again
+// if it failed on the context of its caller rather than their own.
+func (c *Cache) load(ctx context.Context, key string, fetch func() (any, error)) (any, error) {
+	for {
+		c.mu.Lock()
+		if entry, ok := c.entries[key]; ok && time.Now().Before(entry.expires) {
+			c.mu.Unlock()
+			return entry.value, nil
+		}
+		call, ok := c.calls[key]
+		if !ok {
+			break
+		}
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+			if isContextError(call.err) && ctx.Err() == nil {
+				continue
+			}
+			return call.value, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &cacheCall{done: make(chan struct{})}
+	if c.calls == nil {
+		c.calls = map[string]*cacheCall{}
+	}
+	c.calls[key] = call
+	generation := c.generation
+	c.mu.Unlock()
+
+	call.value, call.err = fetch()
+
+	c.mu.Lock()
+	delete(c.calls, key)
+	if ttl := c.ttl(key); call.err == nil && ttl > 0 && generation == c.generation {
+		if c.entries == nil {
+			c.entries = map[string]cacheEntry{}
+		}
+		c.entries[key] = cacheEntry{value: call.value, expires: time.Now().Add(ttl)}
+	}
+	c.mu.Unlock()
+	close(call.done)
+	return call.value, call.err
+}
+
+// Reports whether err comes from a cancelled or expired context.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// Fetches the value of key through the cache of c, if it has one. Slices
+// are copied: callers may modify them, and the cache shares them.
+func cached[T any](ctx context.Context, c *Client, key string, fetch func() (T, error)) (T, error) {
+	if c.Cache == nil {
+		return fetch()
+	}
+	value, err := c.Cache.load(ctx, key, func() (any, error) {
+		return fetch()
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Slice && !v.IsNil() {
+		clone := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(clone, v)
+		value = clone.Interface()
+	}
+	return value.(T), nil
+}
+
+// Drops the cached entries of resources, if c has a cache.
+func (c *Client) invalidate(resources ...string) {
+	if c.Cache != nil {
+		c.Cache.Invalidate(resources...)
+	}
+}
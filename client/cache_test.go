@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheDevices(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: `{"devices": [{"iden": "0xyz", "nickname": "foo"}]}`, status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	client.Cache = NewCache()
+	ctx := context.Background()
+	devices, _ := client.GetDevices(ctx)
+	devices[0].Nickname = "changed"
+	devices, err := client.GetDevices(ctx)
+	if err != nil || len(devices) != 1 || devices[0].Nickname != "foo" {
+		t.Errorf("Expected cached device, got %#v, %v", devices, err)
+	}
+	if len(fakeRT.requests) != 1 {
+		t.Errorf("Expected 1 request, got %d", len(fakeRT.requests))
+	}
+	client.UpdateDevice(ctx, Params{"iden": "0xyz", "nickname": "bar"})
+	client.GetDevices(ctx)
+	if len(fakeRT.requests) != 3 {
+		t.Errorf("Expected devices to be fetched again after an update, got %d requests", len(fakeRT.requests))
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: `{"tag": "jblow"}`, status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	client.Cache = &Cache{ChannelsTTL: 20 * time.Millisecond}
+	ctx := context.Background()
+	client.GetChannel(ctx, Params{"tag": "jblow"})
+	client.GetChannel(ctx, Params{"tag": "jblow"})
+	client.GetChannel(ctx, Params{"tag": "other"})
+	if len(fakeRT.requests) != 2 {
+		t.Errorf("Expected 2 requests, got %d", len(fakeRT.requests))
+	}
+	time.Sleep(30 * time.Millisecond)
+	client.GetChannel(ctx, Params{"tag": "jblow"})
+	client.GetMe(ctx)
+	client.GetMe(ctx)
+	if len(fakeRT.requests) != 5 {
+		t.Errorf("Expected expired and uncached entries to be fetched, got %d requests", len(fakeRT.requests))
+	}
+}
+
+func TestCacheCoalesce(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+	client := newTestClient(roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		return (&FakeRoundTripper{message: `{"email": "foo@example.com"}`, status: http.StatusOK}).RoundTrip(r)
+	}))
+	client.Cache = &Cache{}
+	var wg sync.WaitGroup
+	users := make([]User, 5)
+	for i := range users {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			users[i], _ = client.GetMe(context.Background())
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if requests != 1 {
+		t.Errorf("Expected concurrent calls to share 1 request, got %d", requests)
+	}
+	for _, user := range users {
+		if user.Email != "foo@example.com" {
+			t.Errorf("Expected shared result, got %#v", user)
+		}
+	}
+}
+
+func TestCacheCallerTimeout(t *testing.T) {
+	var requests int32
+	client := newTestClient(roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			<-r.Context().Done()
+			return nil, r.Context().Err()
+		}
+		return (&FakeRoundTripper{message: `{"email": "foo@example.com"}`, status: http.StatusOK}).RoundTrip(r)
+	}))
+	client.MaxRetries = 0
+	client.Cache = NewCache()
+	leader := make(chan error, 1)
+	go func() {
+		_, err := client.GetMe(context.Background(), WithTimeout(50*time.Millisecond))
+		leader <- err
+	}()
+	for atomic.LoadInt32(&requests) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	user, err := client.GetMe(context.Background())
+	if err != nil || user.Email != "foo@example.com" {
+		t.Errorf("Expected the waiter to fetch again, got %#v, %v", user, err)
+	}
+	if err := <-leader; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the leader to time out, got %v", err)
+	}
+}
@@ -2,28 +2,34 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
+	"math/rand"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
 	v2Api        = "https://api.pushbullet.com/v2/"
 	apiEndpoints = Endpoint{
-		"contacts":       v2Api + "contacts",
-		"pushes":         v2Api + "pushes",
-		"devices":        v2Api + "devices",
-		"me":             v2Api + "users/me",
-		"subscriptions":  v2Api + "subscriptions",
-		"channels":       v2Api + "channel-info",
-		"upload_request": v2Api + "upload-request",
+		"contacts":       "contacts",
+		"chats":          "chats",
+		"pushes":         "pushes",
+		"devices":        "devices",
+		"me":             "users/me",
+		"subscriptions":  "subscriptions",
+		"channels":       "channel-info",
+		"upload_request": "upload-request",
+		"ephemerals":     "ephemerals",
 	}
 	noChannelTagError   = errors.New("No channel tag parameter")
 	noIdenError         = errors.New("No iden parameter")
@@ -36,74 +42,280 @@ var (
 	pushNoTypeError     = errors.New("No type error")
 	pushNoFileNameError = errors.New("No filename for push of type file")
 	pushNoFileTypeError = errors.New("No filetype for push of type file")
+
+	// Base delay between retries, doubled on every attempt.
+	retryBackoff = 500 * time.Millisecond
+	// Upper bound for a single wait between retries.
+	maxRetryWait = time.Minute
 )
 
+// Default number of retries for clients created with NewClient.
+const DefaultMaxRetries = 3
+
 // HttpError encapsulates HTTP request errors.
 type HttpError struct {
 	Status  int
 	Message string
+	// Error type and cite as returned by the API, if any.
+	Type string
+	Cite string
 }
 
 func (e *HttpError) Error() string {
 	return fmt.Sprintf("Status: %d, Message: %s", e.Status, e.Message)
 }
 
-// Used for HTTP requests.
-func (c *Client) do(method, endpoint string, body io.Reader) ([]byte, error) {
-	req, err := http.NewRequest(method, endpoint, body)
-	if err != nil {
-		log.Println(err)
+// IsPermanent reports whether err will not go away by retrying: the API
+// rejected the request with a client error other than rate limiting.
+func IsPermanent(err error) bool {
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) {
+		return httpErr.Status >= 400 && httpErr.Status < 500 && httpErr.Status != http.StatusTooManyRequests
+	}
+	return false
+}
+
+// IsUnauthorized reports whether err is the API rejecting the access token.
+func IsUnauthorized(err error) bool {
+	var httpErr *HttpError
+	return errors.As(err, &httpErr) && (httpErr.Status == http.StatusUnauthorized || httpErr.Status == http.StatusForbidden)
+}
+
+// Decodes the error object returned by the API, falling back to a message
+// derived from the status code.
+func newHttpError(status int, body []byte) *HttpError {
+	var resp struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+			Cite    string `json:"cite"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &resp)
+	httpErr := &HttpError{Status: status, Message: resp.Error.Message, Type: resp.Error.Type, Cite: resp.Error.Cite}
+	if httpErr.Message != "" {
+		return httpErr
+	}
+	switch status {
+	case http.StatusBadRequest:
+		httpErr.Message = "Bad Request"
+	case http.StatusUnauthorized:
+		httpErr.Message = "Unauthorized"
+	case http.StatusForbidden:
+		httpErr.Message = "Forbidden"
+	case http.StatusNotFound:
+		httpErr.Message = "StatusNotFound"
+	case http.StatusInternalServerError:
+		httpErr.Message = "Internal Server Error"
+	default:
+		httpErr.Message = http.StatusText(status)
+	}
+	return httpErr
+}
+
+type operationKey struct{}
+
+// Names the logical operation of the requests made with ctx.
+func withOperation(ctx context.Context, op string) context.Context {
+	return context.WithValue(ctx, operationKey{}, op)
+}
+
+func operation(ctx context.Context) string {
+	if op, ok := ctx.Value(operationKey{}).(string); ok {
+		return op
+	}
+	return "Do"
+}
+
+// Do sends an authenticated request to the Pushbullet API and decodes the
+// JSON response into out. It is the building block of every typed method and
+// can be used for endpoints the package does not wrap.
+//
+// path is either relative to the API root ("blocks", "/v2/blocks") or an
+// absolute URL. in, if not nil, is sent as the JSON body. out, if not nil,
+// receives the decoded response. Non 2xx responses are returned as
+// *HttpError. Rate limited requests, and idempotent requests failing with a
+// network or server error, are retried up to MaxRetries times.
+//
+// Usage:
+//   var resp struct{ Blocks []Block `json:"blocks"` }
+//   err := client.Do(ctx, "GET", "blocks", nil, &resp, client.WithTimeout(5*time.Second))
+func (c *Client) Do(ctx context.Context, method, path string, in, out any, opts ...RequestOption) error {
+	ctx, cancel := withRequestOptions(ctx, opts)
+	defer cancel()
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	op := operation(ctx)
+	endpoint := c.url(path)
+	for attempt := 0; ; attempt++ {
+		data, err := c.send(ctx, op, attempt, method, endpoint, body)
+		if err == nil {
+			if out == nil || len(data) == 0 {
+				return nil
+			}
+			return json.Unmarshal(data, out)
+		}
+		wait, ok := c.retryWait(ctx, idempotent(method), attempt, err)
+		if !ok {
+			return err
+		}
+		c.logger().Debug("pushbullet request retry", "op", op, "method", method, "endpoint", endpoint,
+			"attempt", attempt+1, "wait", wait, "error", err)
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// Makes a single attempt of a request.
+func (c *Client) send(ctx context.Context, op string, attempt int, method, endpoint string, body []byte) (data []byte, err error) {
+	ctx, done := c.observe(ctx, op)
+	call := Call{Operation: op, Method: method, Endpoint: endpoint, Attempt: attempt, RateLimitRemaining: -1}
+	start := time.Now()
+	defer func() {
+		call.Duration = time.Since(start)
+		call.Err = err
+		done(call)
+	}()
+
+	log := c.logger().With("op", op, "method", method, "endpoint", endpoint, "attempt", attempt)
+	cfg := requestConfigFrom(ctx)
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		log.Debug("pushbullet request failed", "error", err)
 		return nil, err
 	}
 	req.SetBasicAuth(c.token, "")
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.HttpClient.Do(req)
+	for k, v := range cfg.header {
+		req.Header[k] = v
+	}
+	resp, err := c.httpClient().Do(req)
 	if err != nil {
-		log.Println(err)
+		log.Debug("pushbullet request failed", "latency", time.Since(start), "error", err)
 		return nil, err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusOK {
-		data, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			fmt.Println(err)
-		}
-		return data, nil
-	} else {
-		if resp.StatusCode == http.StatusBadRequest {
-			return nil, &HttpError{Status: resp.StatusCode, Message: "Bad Request"}
-		}
-		if resp.StatusCode == http.StatusUnauthorized {
-			return nil, &HttpError{Status: resp.StatusCode, Message: "Unauthorized"}
-		}
-		if resp.StatusCode == http.StatusForbidden {
-			return nil, &HttpError{Status: resp.StatusCode, Message: "Forbidden"}
-		}
-		if resp.StatusCode == http.StatusNotFound {
-			return nil, &HttpError{Status: resp.StatusCode, Message: "StatusNotFound"}
+	call.Status = resp.StatusCode
+	call.RateLimitRemaining = rateLimitRemaining(resp.Header)
+	c.updateRateLimit(resp.Header)
+	log.Debug("pushbullet request", "status", resp.StatusCode, "latency", time.Since(start))
+	data, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, newHttpError(resp.StatusCode, data)
+	}
+	return data, nil
+}
+
+// Decides whether a failed attempt is retried and how long to wait first.
+// Rate limited requests are always retried once the limit resets; network
+// and server errors only for idempotent requests.
+func (c *Client) retryWait(ctx context.Context, idempotent bool, attempt int, err error) (time.Duration, bool) {
+	if attempt >= c.MaxRetries || ctx.Err() != nil || requestConfigFrom(ctx).noRetry {
+		return 0, false
+	}
+	wait := retryBackoff << uint(attempt)
+	wait += time.Duration(rand.Int63n(int64(wait)/2 + 1))
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) {
+		switch {
+		case httpErr.Status == http.StatusTooManyRequests:
+			if reset := time.Until(c.RateLimit().Reset); reset > 0 {
+				wait = reset
+			}
+		case httpErr.Status >= 500 && idempotent:
+		default:
+			return 0, false
 		}
-		if resp.StatusCode == http.StatusInternalServerError {
-			return nil, &HttpError{Status: resp.StatusCode, Message: "Internal Server Error"}
+	} else if !idempotent {
+		return 0, false
+	}
+	if wait > maxRetryWait {
+		wait = maxRetryWait
+	}
+	return wait, true
+}
+
+// Waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "PUT", "DELETE", "OPTIONS":
+		return true
+	}
+	return false
+}
+
+// Resolves path against the base URL of the client.
+func (c *Client) url(path string) string {
+	if strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://") {
+		return path
+	}
+	base := c.BaseURL
+	if base == "" {
+		base = v2Api
+	}
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "/"), "v2/")
+	return strings.TrimSuffix(base, "/") + "/" + path
+}
+
+// Encodes params as a query string. Floats are written without exponent,
+// as the API expects for timestamps.
+func encodeQuery(params Params) string {
+	values := url.Values{}
+	for k, v := range params {
+		switch v := v.(type) {
+		case float64:
+			values.Set(k, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			values.Set(k, fmt.Sprint(v))
 		}
 	}
-	return nil, nil
+	return values.Encode()
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HttpClient == nil {
+		return http.DefaultClient
+	}
+	return c.HttpClient
 }
 
 // Get information about user.
 // See: https://api.pushbullet.com/v2/users/me
 //
 // Usage:
-//   user, err := client.GetMe()
-func (c *Client) GetMe() (User, error) {
-	body, err := c.do("GET", apiEndpoints["me"], nil)
-	if err != nil {
-		return User{}, err
-	}
-	var user User
-	if err = json.Unmarshal(body, &user); err != nil {
-		return User{}, err
-	}
-	return user, nil
+//   user, err := client.GetMe(ctx)
+func (c *Client) GetMe(ctx context.Context, opts ...RequestOption) (User, error) {
+	return cached(ctx, c, "me", func() (User, error) {
+		var user User
+		if err := c.Do(withOperation(ctx, "GetMe"), "GET", apiEndpoints["me"], nil, &user, opts...); err != nil {
+			return User{}, err
+		}
+		return user, nil
+	})
 }
 
 // Update information about user.
@@ -112,21 +324,14 @@ func (c *Client) GetMe() (User, error) {
 // Usage:
 //   obj := make(map[string]client.Preferences)
 //   obj["preferences"] = client.Preferences{Social: false}
-//   user, err := client.UpdateMe(obj)
+//   user, err := client.UpdateMe(ctx, obj)
 
 // TODO: improve implementation
-func (c *Client) UpdateMe(params map[string]Preferences) (User, error) {
-	jsonParams, err := json.Marshal(params)
-	if err != nil {
-		return User{}, err
-	}
-	body, err := c.do("POST", apiEndpoints["me"], bytes.NewBuffer(jsonParams))
-	if err != nil {
-		return User{}, err
-	}
-
+func (c *Client) UpdateMe(ctx context.Context, params map[string]Preferences, opts ...RequestOption) (User, error) {
 	var user User
-	if err = json.Unmarshal(body, &user); err != nil {
+	err := c.Do(withOperation(ctx, "UpdateMe"), "POST", apiEndpoints["me"], params, &user, opts...)
+	c.invalidate("me")
+	if err != nil {
 		return User{}, err
 	}
 	return user, nil
@@ -136,26 +341,17 @@ func (c *Client) UpdateMe(params map[string]Preferences) (User, error) {
 // See: https://api.pushbullet.com/v2/subscriptions
 
 // Usage:
-//   client.Subscribe(client.Params{
+//   client.Subscribe(ctx, client.Params{
 //     "channel_tag": "jblow"
 //   })
 //
 // If no channel tag is passed a noChannelTagError will be returned.
-func (c *Client) Subscribe(params Params) (Subscription, error) {
+func (c *Client) Subscribe(ctx context.Context, params Params, opts ...RequestOption) (Subscription, error) {
 	if _, ok := params["channel_tag"]; !ok {
 		return Subscription{}, noChannelTagError
 	}
-	jsonParams, err := json.Marshal(params)
-	if err != nil {
-		return Subscription{}, err
-	}
-	body, err := c.do("POST", apiEndpoints["subscriptions"], bytes.NewBuffer(jsonParams))
-	if err != nil {
-		return Subscription{}, err
-	}
-
 	var subscription Subscription
-	if err = json.Unmarshal(body, &subscription); err != nil {
+	if err := c.Do(withOperation(ctx, "Subscribe"), "POST", apiEndpoints["subscriptions"], params, &subscription, opts...); err != nil {
 		return Subscription{}, err
 	}
 	return subscription, nil
@@ -165,15 +361,10 @@ func (c *Client) Subscribe(params Params) (Subscription, error) {
 // See: https://api.pushbullet.com/v2/subscriptions
 //
 // Usage:
-//   subscriptions, err := client.Subscribtions()
-func (c *Client) Subscriptions() ([]Subscription, error) {
-	body, err := c.do("GET", apiEndpoints["subscriptions"], nil)
-	if err != nil {
-		return nil, err
-	}
-
+//   subscriptions, err := client.Subscribtions(ctx)
+func (c *Client) Subscriptions(ctx context.Context, opts ...RequestOption) ([]Subscription, error) {
 	var resultSet Subscriptions
-	if err = json.Unmarshal(body, &resultSet); err != nil {
+	if err := c.Do(withOperation(ctx, "Subscriptions"), "GET", apiEndpoints["subscriptions"], nil, &resultSet, opts...); err != nil {
 		return nil, err
 	}
 	return resultSet.Subscriptions, nil
@@ -183,45 +374,38 @@ func (c *Client) Subscriptions() ([]Subscription, error) {
 // See: https://docs.pushbullet.com/v2/subscriptions/
 //
 // Usage:
-//   channel, err := client.GetChannel(client.Params{"tag": "jblow"})
+//   channel, err := client.GetChannel(ctx, client.Params{"tag": "jblow"})
 //
 // If no channel tag is passed, a noChannelTagError will be returned.
-func (c *Client) GetChannel(params Params) (Channel, error) {
+func (c *Client) GetChannel(ctx context.Context, params Params, opts ...RequestOption) (Channel, error) {
 	tag, ok := params["tag"]
 	if !ok {
 		return Channel{}, noChannelTagError
 	}
-	endpoint := fmt.Sprintf(apiEndpoints["channels"]+"?tag=%s", tag)
-	body, err := c.do("GET", endpoint, nil)
-	if err != nil {
-		return Channel{}, err
-	}
-
-	var channel Channel
-	if err = json.Unmarshal(body, &channel); err != nil {
-		return Channel{}, err
-	}
-	return channel, nil
+	endpoint := apiEndpoints["channels"] + "?tag=" + url.QueryEscape(fmt.Sprint(tag))
+	return cached(ctx, c, "channels/"+fmt.Sprint(tag), func() (Channel, error) {
+		var channel Channel
+		if err := c.Do(withOperation(ctx, "GetChannel"), "GET", endpoint, nil, &channel, opts...); err != nil {
+			return Channel{}, err
+		}
+		return channel, nil
+	})
 }
 
 // Unsubscribe from a channel.
 // See: https://api.pushbullet.com/v2/subscriptions
 //
 // Usage:
-//   err := client.Subscribe(client.Params{"iden": "0xbababcdk"})
+//   err := client.Subscribe(ctx, client.Params{"iden": "0xbababcdk"})
 //
 // If no iden is passed a noIdenError will be returned.
-func (c *Client) Unsubscribe(params Params) error {
+func (c *Client) Unsubscribe(ctx context.Context, params Params, opts ...RequestOption) error {
 	id, ok := params["iden"]
 	if !ok {
 		return noIdenError
 	}
 	endpoint := fmt.Sprintf(apiEndpoints["subscriptions"]+"/%s", id)
-	_, err := c.do("DELETE", endpoint, nil)
-	if err != nil {
-		return err
-	}
-	return nil
+	return c.Do(withOperation(ctx, "Unsubscribe"), "DELETE", endpoint, nil, nil, opts...)
 }
 
 //UPDATED - 12/2014 - need new tests and review of active/non active contacts
@@ -229,15 +413,10 @@ func (c *Client) Unsubscribe(params Params) error {
 // See: https://docs.pushbullet.com/v2/contacts/
 //
 // Usage:
-//   contacts, err := client.GetContacts()
-func (c *Client) GetContacts() ([]Contact, error) {
-	body, err := c.do("GET", apiEndpoints["contacts"], nil)
-	if err != nil {
-		return nil, err
-	}
-
+//   contacts, err := client.GetContacts(ctx)
+func (c *Client) GetContacts(ctx context.Context, opts ...RequestOption) ([]Contact, error) {
 	var resultSet Contacts
-	if err = json.Unmarshal(body, &resultSet); err != nil {
+	if err := c.Do(withOperation(ctx, "GetContacts"), "GET", apiEndpoints["contacts"], nil, &resultSet, opts...); err != nil {
 		return nil, err
 	}
 	return resultSet.Contacts, nil
@@ -247,25 +426,16 @@ func (c *Client) GetContacts() ([]Contact, error) {
 // See: https://docs.pushbullet.com/v2/contacts/
 //
 // Usage:
-//   contact, err := client.CreateContact(client.Params{"name": "foo", "email": "bar"})
-func (c *Client) CreateContact(params Params) (Contact, error) {
+//   contact, err := client.CreateContact(ctx, client.Params{"name": "foo", "email": "bar"})
+func (c *Client) CreateContact(ctx context.Context, params Params, opts ...RequestOption) (Contact, error) {
 	if _, ok := params["name"]; !ok {
 		return Contact{}, errors.New("no name has been given")
 	}
 	if _, ok := params["email"]; !ok {
 		return Contact{}, errors.New("no email has been given")
 	}
-	jsonParams, err := json.Marshal(params)
-	if err != nil {
-		return Contact{}, err
-	}
-	body, err := c.do("POST", apiEndpoints["contacts"], bytes.NewBuffer(jsonParams))
-	if err != nil {
-		return Contact{}, err
-	}
-
 	var contact Contact
-	if err = json.Unmarshal(body, &contact); err != nil {
+	if err := c.Do(withOperation(ctx, "CreateContact"), "POST", apiEndpoints["contacts"], params, &contact, opts...); err != nil {
 		return Contact{}, err
 	}
 	return contact, nil
@@ -275,10 +445,10 @@ func (c *Client) CreateContact(params Params) (Contact, error) {
 // See: https://docs.pushbullet.com/v2/contacts/
 //
 // Usage:
-//   contact, err := client.UpdateContact(client.Params{"iden": "0xyz", "name": "foo"})
+//   contact, err := client.UpdateContact(ctx, client.Params{"iden": "0xyz", "name": "foo"})
 //
 // If no iden is passed a noIdenError is returned.
-func (c *Client) UpdateContact(params Params) (Contact, error) {
+func (c *Client) UpdateContact(ctx context.Context, params Params, opts ...RequestOption) (Contact, error) {
 	id, ok := params["iden"]
 	if !ok {
 		return Contact{}, noIdenError
@@ -286,17 +456,8 @@ func (c *Client) UpdateContact(params Params) (Contact, error) {
 	delete(params, "iden")
 	endpoint := fmt.Sprintf(apiEndpoints["contacts"]+"/%s", id)
 
-	jsonParams, err := json.Marshal(params)
-	if err != nil {
-		return Contact{}, err
-	}
-	body, err := c.do("POST", endpoint, bytes.NewBuffer(jsonParams))
-	if err != nil {
-		return Contact{}, err
-	}
-
 	var contact Contact
-	if err = json.Unmarshal(body, &contact); err != nil {
+	if err := c.Do(withOperation(ctx, "UpdateContact"), "POST", endpoint, params, &contact, opts...); err != nil {
 		return Contact{}, err
 	}
 	return contact, nil
@@ -306,63 +467,78 @@ func (c *Client) UpdateContact(params Params) (Contact, error) {
 // See: https://docs.pushbullet.com/v2/contacts/
 //
 // Usage:
-//   contact, err := client.DeleteContact(client.Params{"iden": "0xyz")
+//   contact, err := client.DeleteContact(ctx, client.Params{"iden": "0xyz")
 //
 // If no iden is passed a noIdenError is returned.
-func (c *Client) DeleteContact(params Params) error {
+func (c *Client) DeleteContact(ctx context.Context, params Params, opts ...RequestOption) error {
 	id, ok := params["iden"]
 	if !ok {
 		return noIdenError
 	}
 	endpoint := fmt.Sprintf(apiEndpoints["contacts"]+"/%s", id)
-	_, err := c.do("DELETE", endpoint, nil)
-	if err != nil {
-		return err
-	}
-	return nil
+	return c.Do(withOperation(ctx, "DeleteContact"), "DELETE", endpoint, nil, nil, opts...)
 }
 
-// Get all devices.
-// See: https://docs.pushbullet.com/v2/devices/
+// Get chats.
+// See: https://docs.pushbullet.com/#list-chats
 //
 // Usage:
-//   devices, err := client.GetDevices()
-func (c *Client) GetDevices() ([]Device, error) {
-	body, err := c.do("GET", apiEndpoints["devices"], nil)
-	if err != nil {
+//   chats, err := client.GetChats(ctx)
+func (c *Client) GetChats(ctx context.Context, opts ...RequestOption) ([]Chat, error) {
+	var resultSet Chats
+	if err := c.Do(withOperation(ctx, "GetChats"), "GET", apiEndpoints["chats"], nil, &resultSet, opts...); err != nil {
 		return nil, err
 	}
+	return resultSet.Chats, nil
+}
 
-	var resultSet Devices
-	if err = json.Unmarshal(body, &resultSet); err != nil {
-		return nil, err
+// Create chat.
+// See: https://docs.pushbullet.com/#create-chat
+//
+// Usage:
+//   chat, err := client.CreateChat(ctx, client.Params{"email": "carmack@idsoftware.com"})
+func (c *Client) CreateChat(ctx context.Context, params Params, opts ...RequestOption) (Chat, error) {
+	if _, ok := params["email"]; !ok {
+		return Chat{}, errors.New("no email has been given")
 	}
-	return resultSet.Devices, nil
+	var chat Chat
+	if err := c.Do(withOperation(ctx, "CreateChat"), "POST", apiEndpoints["chats"], params, &chat, opts...); err != nil {
+		return Chat{}, err
+	}
+	return chat, nil
+}
+
+// Get all devices.
+// See: https://docs.pushbullet.com/v2/devices/
+//
+// Usage:
+//   devices, err := client.GetDevices(ctx)
+func (c *Client) GetDevices(ctx context.Context, opts ...RequestOption) ([]Device, error) {
+	return cached(ctx, c, "devices", func() ([]Device, error) {
+		var resultSet Devices
+		if err := c.Do(withOperation(ctx, "GetDevices"), "GET", apiEndpoints["devices"], nil, &resultSet, opts...); err != nil {
+			return nil, err
+		}
+		return resultSet.Devices, nil
+	})
 }
 
 // Create device.
 // See: https://docs.pushbullet.com/v2/devices/
 //
 // Usage:
-//   device, err := client.CreateDevice(client.Params{"nickname": "foo", "type": "stream"})
-func (c *Client) CreateDevice(params Params) (Device, error) {
+//   device, err := client.CreateDevice(ctx, client.Params{"nickname": "foo", "type": "stream"})
+func (c *Client) CreateDevice(ctx context.Context, params Params, opts ...RequestOption) (Device, error) {
 	if _, ok := params["nickname"]; !ok {
 		return Device{}, errors.New("no nickname has been given")
 	}
 	if _, ok := params["type"]; !ok {
 		return Device{}, errors.New("no type has been given")
 	}
-	jsonParams, err := json.Marshal(params)
-	if err != nil {
-		return Device{}, err
-	}
-	body, err := c.do("POST", apiEndpoints["devices"], bytes.NewBuffer(jsonParams))
-	if err != nil {
-		return Device{}, err
-	}
-
 	var device Device
-	if err = json.Unmarshal(body, &device); err != nil {
+	err := c.Do(withOperation(ctx, "CreateDevice"), "POST", apiEndpoints["devices"], params, &device, opts...)
+	c.invalidate("devices")
+	if err != nil {
 		return Device{}, err
 	}
 	return device, nil
@@ -372,8 +548,8 @@ func (c *Client) CreateDevice(params Params) (Device, error) {
 // See: https://docs.pushbullet.com/v2/devices/
 //
 // Usage:
-//   device, err := client.UpdateDevice(client.Params{"iden": "0xyz", "nickname": "foo"})
-func (c *Client) UpdateDevice(params Params) (Device, error) {
+//   device, err := client.UpdateDevice(ctx, client.Params{"iden": "0xyz", "nickname": "foo"})
+func (c *Client) UpdateDevice(ctx context.Context, params Params, opts ...RequestOption) (Device, error) {
 	id, ok := params["iden"]
 	if !ok {
 		return Device{}, noIdenError
@@ -381,17 +557,10 @@ func (c *Client) UpdateDevice(params Params) (Device, error) {
 	delete(params, "iden")
 	endpoint := fmt.Sprintf(apiEndpoints["devices"]+"/%s", id)
 
-	jsonParams, err := json.Marshal(params)
-	if err != nil {
-		return Device{}, err
-	}
-	body, err := c.do("POST", endpoint, bytes.NewBuffer(jsonParams))
-	if err != nil {
-		return Device{}, err
-	}
-
 	var device Device
-	if err = json.Unmarshal(body, &device); err != nil {
+	err := c.Do(withOperation(ctx, "UpdateDevice"), "POST", endpoint, params, &device, opts...)
+	c.invalidate("devices")
+	if err != nil {
 		return Device{}, err
 	}
 	return device, nil
@@ -401,56 +570,84 @@ func (c *Client) UpdateDevice(params Params) (Device, error) {
 // See: https://docs.pushbullet.com/v2/devices/
 //
 // Usage:
-//   err := client.DeleteDevice(client.Params{"iden": "0xyz"})
+//   err := client.DeleteDevice(ctx, client.Params{"iden": "0xyz"})
 
 // If no iden is provided a noIdenError is returned.
-func (c *Client) DeleteDevice(params Params) error {
+func (c *Client) DeleteDevice(ctx context.Context, params Params, opts ...RequestOption) error {
 	id, ok := params["iden"]
 	if !ok {
 		return noIdenError
 	}
 	endpoint := fmt.Sprintf(apiEndpoints["devices"]+"/%s", id)
-	_, err := c.do("DELETE", endpoint, nil)
-	if err != nil {
-		return err
-	}
-	return nil
+	defer c.invalidate("devices")
+	return c.Do(withOperation(ctx, "DeleteDevice"), "DELETE", endpoint, nil, nil, opts...)
 }
 
 // Get pushes.
 // See: https://docs.pushbullet.com/v2/pushes/
 //
 // Usage:
-//   pushes, err := client.GetPushes()
-func (c *Client) GetPushes() ([]Push, error) {
-	//TODO add params and allow modified_after
-	body, err := c.do("GET", apiEndpoints["pushes"], nil)
-	if err != nil {
-		return nil, err
-	}
-
-	var resultSet Pushes
-	if err = json.Unmarshal(body, &resultSet); err != nil {
-		return nil, err
+//   pushes, err := client.GetPushes(ctx, nil)
+//   pushes, err := client.GetPushes(ctx, client.Params{"modified_after": 1411595135.96, "active": true})
+//
+// Params are sent as query parameters. All pages are fetched by following
+// the cursor, unless a "limit" is given, which caps the number of pushes
+// returned.
+func (c *Client) GetPushes(ctx context.Context, params Params, opts ...RequestOption) ([]Push, error) {
+	ctx, cancel := withRequestOptions(ctx, opts)
+	defer cancel()
+	query := Params{}
+	for k, v := range params {
+		query[k] = v
+	}
+	limit, _ := strconv.Atoi(fmt.Sprint(params["limit"]))
+
+	var pushes []Push
+	for {
+		var resultSet Pushes
+		endpoint := apiEndpoints["pushes"] + "?" + encodeQuery(query)
+		if err := c.Do(withOperation(ctx, "GetPushes"), "GET", endpoint, nil, &resultSet); err != nil {
+			return nil, err
+		}
+		pushes = append(pushes, resultSet.Pushes...)
+		if limit > 0 && len(pushes) >= limit {
+			return pushes[:limit], nil
+		}
+		if resultSet.Cursor == "" {
+			return pushes, nil
+		}
+		query["cursor"] = resultSet.Cursor
 	}
-	return resultSet.Pushes, nil
 }
 
 // Create push.
 // See: https://docs.pushbullet.com/v2/pushes/
 //
 // Usage:
-//   push, err := client.CreatePush(client.Params{"type": "link", "title": "baz"})
-//   push, err := client.CreatePush(client.Params{"type": "address", "address": "baz"})
-//   push, err := client.CreatePush(client.Params{"type": "list", "title": "titulo", "items": []string{"foo", "bar"}})
-//   push, err := client.CreatePush(client.Params{"type": "file", "file_name": "foo.txt", "file_type": "text/plain"})
-func (c *Client) CreatePush(params Params) (Push, error) {
+//   push, err := client.CreatePush(ctx, client.Params{"type": "link", "title": "baz", "url": "http://foo.com"})
+//   push, err := client.CreatePush(ctx, client.Params{"type": "address", "address": "baz"})
+//   push, err := client.CreatePush(ctx, client.Params{"type": "list", "title": "titulo", "items": []string{"foo", "bar"}})
+//   push, err := client.CreatePush(ctx, client.Params{"type": "file", "file_name": "foo.txt", "file_type": "text/plain"})
+//
+// File pushes upload file_name unless a file_url is given.
+//
+// Every push is created with a guid, taken from WithIdempotencyGUID, the
+// "guid" param or generated. params is left untouched. Failed creates are
+// retried with the same guid, and before resending the client looks for a
+// push with that guid among the recent pushes, so retries do not create
+// duplicates.
+//
+// After EnsureDevice, pushes are sent from the device of the program unless
+// a source_device_iden is given.
+func (c *Client) CreatePush(ctx context.Context, params Params, opts ...RequestOption) (Push, error) {
 	if _, ok := params["type"]; !ok {
 		return Push{}, pushNoTypeError
 	}
 	switch params["type"] {
 	case "link":
-		if _, ok := params["link"]; !ok {
+		_, hasLink := params["link"]
+		_, hasUrl := params["url"]
+		if !hasLink && !hasUrl {
 			return Push{}, pushNoLinkError
 		}
 	case "address":
@@ -469,39 +666,39 @@ func (c *Client) CreatePush(params Params) (Push, error) {
 			return Push{}, pushNoFileTypeError
 		}
 	}
-	if params["type"] == "file" {
+	ctx, cancel := withRequestOptions(ctx, opts)
+	defer cancel()
+	// A reused params must not carry the guid of this push to the next.
+	params = copyParams(params)
+	if guid := requestConfigFrom(ctx).guid; guid != "" {
+		params["guid"] = guid
+	}
+	if _, ok := params["guid"]; !ok {
+		params["guid"] = NewGUID()
+	}
+	if _, ok := params["source_device_iden"]; !ok && c.DeviceIden() != "" {
+		params["source_device_iden"] = c.DeviceIden()
+	}
+	if _, ok := params["file_url"]; params["type"] == "file" && !ok {
 		filename := params["file_name"].(string)
 		filetype := params["file_type"].(string)
-		url, err := c.PushFile(filename, filetype, filename)
+		fileUrl, err := c.PushFile(ctx, filename, filetype, filename)
 		if err != nil {
 			return Push{}, err
 		}
-		params["file_url"] = url
+		params["file_url"] = fileUrl
 	}
-	jsonParams, err := json.Marshal(params)
-	if err != nil {
-		return Push{}, err
-	}
-	body, err := c.do("POST", apiEndpoints["pushes"], bytes.NewBuffer(jsonParams))
-	if err != nil {
-		return Push{}, err
-	}
-
-	var push Push
-	if err = json.Unmarshal(body, &push); err != nil {
-		return Push{}, err
-	}
-	return push, nil
+	return c.createPush(withOperation(ctx, "CreatePush"), params)
 }
 
 // Update push.
 // See: https://docs.pushbullet.com/v2/pushes/
 //
 // Usage:
-//   push, err := client.UpdatePush(client.Params{"iden": "0xyz", "title": "foobaz"})
+//   push, err := client.UpdatePush(ctx, client.Params{"iden": "0xyz", "title": "foobaz"})
 //
 // If no iden is provided a noIdenError is returned.
-func (c *Client) UpdatePush(params Params) (Push, error) {
+func (c *Client) UpdatePush(ctx context.Context, params Params, opts ...RequestOption) (Push, error) {
 	id, ok := params["iden"]
 	if !ok {
 		return Push{}, noIdenError
@@ -509,17 +706,8 @@ func (c *Client) UpdatePush(params Params) (Push, error) {
 	delete(params, "iden")
 	endpoint := fmt.Sprintf(apiEndpoints["pushes"]+"/%s", id)
 
-	jsonParams, err := json.Marshal(params)
-	if err != nil {
-		return Push{}, err
-	}
-	body, err := c.do("POST", endpoint, bytes.NewBuffer(jsonParams))
-	if err != nil {
-		return Push{}, err
-	}
-
 	var push Push
-	if err = json.Unmarshal(body, &push); err != nil {
+	if err := c.Do(withOperation(ctx, "UpdatePush"), "POST", endpoint, params, &push, opts...); err != nil {
 		return Push{}, err
 	}
 	return push, nil
@@ -529,45 +717,77 @@ func (c *Client) UpdatePush(params Params) (Push, error) {
 // See: https://docs.pushbullet.com/v2/pushes/
 //
 // Usage:
-//   push, err := client.DeletePush(client.Params{"iden": "0xyz"})
+//   push, err := client.DeletePush(ctx, client.Params{"iden": "0xyz"})
 //
 // If no iden is provided a noIdenError is returned.
-func (c *Client) DeletePush(params Params) error {
+func (c *Client) DeletePush(ctx context.Context, params Params, opts ...RequestOption) error {
 	id, ok := params["iden"]
 	if !ok {
 		return noIdenError
 	}
 	endpoint := fmt.Sprintf(apiEndpoints["pushes"]+"/%s", id)
-	_, err := c.do("DELETE", endpoint, nil)
-	if err != nil {
-		return err
+	return c.Do(withOperation(ctx, "DeletePush"), "DELETE", endpoint, nil, nil, opts...)
+}
+
+// Delete all pushes.
+// See: https://docs.pushbullet.com/#delete-all-pushes
+//
+// Usage:
+//   err := client.DeleteAllPushes(ctx)
+func (c *Client) DeleteAllPushes(ctx context.Context, opts ...RequestOption) error {
+	return c.Do(withOperation(ctx, "DeleteAllPushes"), "DELETE", apiEndpoints["pushes"], nil, nil, opts...)
+}
+
+// Send ephemeral.
+// See: https://docs.pushbullet.com/#ephemerals
+//
+// Usage:
+//   err := client.PushEphemeral(ctx, client.Params{"type": "clip", "body": "foo"})
+//
+// Ephemerals are not stored: they are delivered on the realtime event stream
+// of every device of the account. After EnsureDevice, they are sent from the
+// device of the program unless a source_device_iden is given. After
+// SetEncryptionPassword, they are encrypted unless WithEncryption(false) is
+// given.
+func (c *Client) PushEphemeral(ctx context.Context, push Params, opts ...RequestOption) error {
+	if _, ok := push["type"]; !ok {
+		return pushNoTypeError
+	}
+	if _, ok := push["source_device_iden"]; !ok && c.DeviceIden() != "" {
+		push["source_device_iden"] = c.DeviceIden()
+	}
+	ctx, cancel := withRequestOptions(ctx, opts)
+	defer cancel()
+	key := c.key()
+	if enabled := requestConfigFrom(ctx).encryption; enabled != nil && !*enabled {
+		key = nil
+	} else if enabled != nil && key == nil {
+		return noEncryptionKeyError
+	}
+	if key != nil {
+		var err error
+		if push, err = encrypt(key, push); err != nil {
+			return err
+		}
 	}
-	return nil
+	params := Params{"type": "push", "push": push}
+	return c.Do(withOperation(ctx, "PushEphemeral"), "POST", apiEndpoints["ephemerals"], params, nil)
 }
 
 // Upload request.
 // See: https://docs.pushbullet.com/v2/upload-request/
 //
 // Usage:
-//   req, err := client.UploadRequest(client.Params{"file_name": "foo", "file_type": "text"})
-func (c *Client) UploadRequest(params Params) (UploadRequest, error) {
+//   req, err := client.UploadRequest(ctx, client.Params{"file_name": "foo", "file_type": "text"})
+func (c *Client) UploadRequest(ctx context.Context, params Params, opts ...RequestOption) (UploadRequest, error) {
 	if _, ok := params["file_name"]; !ok {
 		return UploadRequest{}, noFileNameError
 	}
 	if _, ok := params["file_type"]; !ok {
 		return UploadRequest{}, noFileTypeError
 	}
-	jsonParams, err := json.Marshal(params)
-	if err != nil {
-		return UploadRequest{}, err
-	}
-	body, err := c.do("POST", apiEndpoints["upload_request"], bytes.NewBuffer(jsonParams))
-	if err != nil {
-		return UploadRequest{}, err
-	}
-
 	var uploadRequest UploadRequest
-	if err = json.Unmarshal(body, &uploadRequest); err != nil {
+	if err := c.Do(withOperation(ctx, "UploadRequest"), "POST", apiEndpoints["upload_request"], params, &uploadRequest, opts...); err != nil {
 		return UploadRequest{}, err
 	}
 	return uploadRequest, nil
@@ -577,15 +797,27 @@ func (c *Client) UploadRequest(params Params) (UploadRequest, error) {
 // See: https://docs.pushbullet.com/v2/pushes/
 //
 // Usage:
-//   fileUrl, err := client.PushFile("foo.txt", "text/plain", "foo.txt")
-func (c *Client) PushFile(filename, filetype, path string) (string, error) {
-	req, err := c.UploadRequest(Params{
+//   fileUrl, err := client.PushFile(ctx, "foo.txt", "text/plain", "foo.txt")
+func (c *Client) PushFile(ctx context.Context, filename, filetype, path string, opts ...RequestOption) (fileUrl string, err error) {
+	ctx, cancel := withRequestOptions(ctx, opts)
+	defer cancel()
+	ctx, done := c.observe(ctx, "PushFile")
+	call := Call{Operation: "PushFile", Method: "POST", RateLimitRemaining: -1}
+	start := time.Now()
+	defer func() {
+		call.Duration = time.Since(start)
+		call.Err = err
+		done(call)
+	}()
+
+	req, err := c.UploadRequest(ctx, Params{
 		"file_name": filename,
 		"file_type": filetype,
 	})
 	if err != nil {
 		return "", err
 	}
+	call.Endpoint = req.UploadUrl
 	file, err := os.Open(path)
 	if err != nil {
 		return "", err
@@ -611,16 +843,21 @@ func (c *Client) PushFile(filename, filetype, path string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	uploadReq, err := http.NewRequest("POST", req.UploadUrl, body)
-	uploadReq.Header.Set("Content-Type", writer.FormDataContentType())
+	call.BytesUploaded = int64(body.Len())
+	uploadReq, err := http.NewRequestWithContext(ctx, "POST", req.UploadUrl, body)
 	if err != nil {
 		return "", err
 	}
-	client := &http.Client{}
-	resp, err := client.Do(uploadReq)
+	uploadReq.Header.Set("Content-Type", writer.FormDataContentType())
+	log := c.logger().With("method", "POST", "endpoint", req.UploadUrl, "file_name", filename)
+	resp, err := c.httpClient().Do(uploadReq)
 	if err != nil {
+		log.Debug("pushbullet upload failed", "latency", time.Since(start), "error", err)
 		return "", err
 	}
+	defer resp.Body.Close()
+	call.Status = resp.StatusCode
+	log.Debug("pushbullet upload", "status", resp.StatusCode, "latency", time.Since(start))
 	if resp.StatusCode != http.StatusNoContent {
 		return "", errors.New("error uploading file")
 	}
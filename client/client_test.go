@@ -1,12 +1,15 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 type FakeRoundTripper struct {
@@ -16,7 +19,7 @@ type FakeRoundTripper struct {
 	requests []*http.Request
 }
 
-func newTestClient(rt *FakeRoundTripper) *Client {
+func newTestClient(rt http.RoundTripper) *Client {
 	client := &Client{
 		token:      "foobar",
 		HttpClient: &http.Client{Transport: rt},
@@ -69,7 +72,7 @@ func TestGetMe(t *testing.T) {
 	}
 	fakeRT := &FakeRoundTripper{message: body, status: http.StatusOK}
 	client := newTestClient(fakeRT)
-	got, _ := client.GetMe()
+	got, _ := client.GetMe(context.Background())
 	if !reflect.DeepEqual(got, expected) {
 		t.Errorf("Error, expected %#v, got %#v", expected, got)
 	}
@@ -82,7 +85,7 @@ func TestUpdateMe(t *testing.T) {
 func TestSubscribeNoChannelTag(t *testing.T) {
 	fakeRT := &FakeRoundTripper{message: "", status: http.StatusOK}
 	client := newTestClient(fakeRT)
-	_, err := client.Subscribe(Params{})
+	_, err := client.Subscribe(context.Background(), Params{})
 	if err != noChannelTagError {
 		t.Errorf("Error, expected %#v, got %#v", noChannelTagError.Error(), err)
 	}
@@ -111,7 +114,7 @@ func TestSubscribeChannel(t *testing.T) {
 	}
 	fakeRT := &FakeRoundTripper{message: body, status: http.StatusOK}
 	client := newTestClient(fakeRT)
-	got, _ := client.Subscribe(Params{"channel_tag": "jblow"})
+	got, _ := client.Subscribe(context.Background(), Params{"channel_tag": "jblow"})
 	if !reflect.DeepEqual(got, expected) {
 		t.Errorf("Error, expected %#v, got %#v", expected, got)
 	}
@@ -120,7 +123,7 @@ func TestSubscribeChannel(t *testing.T) {
 func TestGetChannelNoChannel(t *testing.T) {
 	fakeRT := &FakeRoundTripper{message: "", status: http.StatusOK}
 	client := newTestClient(fakeRT)
-	_, err := client.GetChannel(Params{})
+	_, err := client.GetChannel(context.Background(), Params{})
 	if err != noChannelTagError {
 		t.Errorf("Error, expected %#v, got %#v", noChannelTagError.Error(), err)
 	}
@@ -143,7 +146,7 @@ func TestGetChannel(t *testing.T) {
 	}
 	fakeRT := &FakeRoundTripper{message: body, status: http.StatusOK}
 	client := newTestClient(fakeRT)
-	got, _ := client.GetChannel(Params{"tag": "jblow"})
+	got, _ := client.GetChannel(context.Background(), Params{"tag": "jblow"})
 	if !reflect.DeepEqual(got, expected) {
 		t.Errorf("Error, expected %#v, got %#v", expected, got)
 	}
@@ -152,7 +155,7 @@ func TestGetChannel(t *testing.T) {
 func TestUnsubscribeNoIden(t *testing.T) {
 	fakeRT := &FakeRoundTripper{message: "", status: http.StatusOK}
 	client := newTestClient(fakeRT)
-	err := client.Unsubscribe(Params{})
+	err := client.Unsubscribe(context.Background(), Params{})
 	if err != noIdenError {
 		t.Errorf("Error, expected %#v, got %#v", noIdenError, err)
 	}
@@ -161,7 +164,7 @@ func TestUnsubscribeNoIden(t *testing.T) {
 func TestUnsubscribe(t *testing.T) {
 	fakeRT := &FakeRoundTripper{message: "", status: http.StatusOK}
 	client := newTestClient(fakeRT)
-	err := client.Unsubscribe(Params{"iden": "0xyz"})
+	err := client.Unsubscribe(context.Background(), Params{"iden": "0xyz"})
 	if err != nil {
 		t.Errorf("Expected no error, got %#v", err)
 	}
@@ -190,7 +193,7 @@ func TestGetContacts(t *testing.T) {
 	}
 	fakeRT := &FakeRoundTripper{message: body, status: http.StatusOK}
 	client := newTestClient(fakeRT)
-	got, _ := client.GetContacts()
+	got, _ := client.GetContacts(context.Background())
 	if !reflect.DeepEqual(got, expected.Contacts) {
 		t.Errorf("Error, expected %#v, got %#v", expected, got)
 	}
@@ -198,11 +201,11 @@ func TestGetContacts(t *testing.T) {
 
 func TestCreateContactError(t *testing.T) {
 	client := Client{}
-	_, err := client.CreateContact(Params{})
+	_, err := client.CreateContact(context.Background(), Params{})
 	if err.Error() != "no name has been given" {
 		t.Errorf("Error, expected no name has been given, got %#v", err)
 	}
-	_, err = client.CreateContact(Params{"name": "foo"})
+	_, err = client.CreateContact(context.Background(), Params{"name": "foo"})
 	if err.Error() != "no email has been given" {
 		t.Errorf("Error, expected no email has been given, got %#v", err)
 	}
@@ -227,7 +230,7 @@ func TestCreateContact(t *testing.T) {
 	}
 	fakeRT := &FakeRoundTripper{message: body, status: http.StatusOK}
 	client := newTestClient(fakeRT)
-	got, _ := client.CreateContact(Params{"name": "foo", "email": "bar"})
+	got, _ := client.CreateContact(context.Background(), Params{"name": "foo", "email": "bar"})
 	if !reflect.DeepEqual(got, expected) {
 		t.Errorf("Error, expected %#v, got %#v", expected, got)
 	}
@@ -235,7 +238,7 @@ func TestCreateContact(t *testing.T) {
 
 func TestUpdateContactError(t *testing.T) {
 	client := Client{}
-	_, err := client.UpdateContact(Params{})
+	_, err := client.UpdateContact(context.Background(), Params{})
 	if err != noIdenError {
 		t.Errorf("Error, expected noIdenError, got %#v", err)
 	}
@@ -260,7 +263,7 @@ func TestUpdateContact(t *testing.T) {
 	}
 	fakeRT := &FakeRoundTripper{message: body, status: http.StatusOK}
 	client := newTestClient(fakeRT)
-	got, _ := client.UpdateContact(Params{"iden": "0xyz", "email": "bar"})
+	got, _ := client.UpdateContact(context.Background(), Params{"iden": "0xyz", "email": "bar"})
 	if !reflect.DeepEqual(got, expected) {
 		t.Errorf("Error, expected %#v, got %#v", expected, got)
 	}
@@ -269,7 +272,7 @@ func TestUpdateContact(t *testing.T) {
 func TestDeleteContact(t *testing.T) {
 	fakeRT := &FakeRoundTripper{message: "", status: http.StatusOK}
 	client := newTestClient(fakeRT)
-	err := client.DeleteContact(Params{"iden": "0xyz"})
+	err := client.DeleteContact(context.Background(), Params{"iden": "0xyz"})
 	if err != nil {
 		t.Errorf("Error, expected nil, got %#v", err)
 	}
@@ -304,7 +307,7 @@ func TestGetDevices(t *testing.T) {
 	}
 	fakeRT := &FakeRoundTripper{message: body, status: http.StatusOK}
 	client := newTestClient(fakeRT)
-	got, _ := client.GetDevices()
+	got, _ := client.GetDevices(context.Background())
 	if !reflect.DeepEqual(got, expected.Devices) {
 		t.Errorf("Error, expected %#v, got %#v", expected, got)
 	}
@@ -312,11 +315,11 @@ func TestGetDevices(t *testing.T) {
 
 func TestCreateDeviceError(t *testing.T) {
 	client := Client{}
-	_, err := client.CreateDevice(Params{})
+	_, err := client.CreateDevice(context.Background(), Params{})
 	if err.Error() != "no nickname has been given" {
 		t.Errorf("Error, expected no nickname has been given, got %#v", err)
 	}
-	_, err = client.CreateDevice(Params{"nickname": "foo"})
+	_, err = client.CreateDevice(context.Background(), Params{"nickname": "foo"})
 	if err.Error() != "no type has been given" {
 		t.Errorf("Error, expected no type has been given, got %#v", err)
 	}
@@ -341,7 +344,7 @@ func TestCreateDevice(t *testing.T) {
 	}
 	fakeRT := &FakeRoundTripper{message: body, status: http.StatusOK}
 	client := newTestClient(fakeRT)
-	got, _ := client.CreateDevice(Params{"nickname": "foo", "type": "stream"})
+	got, _ := client.CreateDevice(context.Background(), Params{"nickname": "foo", "type": "stream"})
 	if !reflect.DeepEqual(got, expected) {
 		t.Errorf("Error, expected %#v, got %#v", expected, got)
 	}
@@ -349,7 +352,7 @@ func TestCreateDevice(t *testing.T) {
 
 func TestUpdateDeviceError(t *testing.T) {
 	client := Client{}
-	_, err := client.UpdateDevice(Params{})
+	_, err := client.UpdateDevice(context.Background(), Params{})
 	if err != noIdenError {
 		t.Errorf("Expected %#v, got %#v", noIdenError, err)
 	}
@@ -374,7 +377,7 @@ func TestUpdateDevice(t *testing.T) {
 	}
 	fakeRT := &FakeRoundTripper{message: body, status: http.StatusOK}
 	client := newTestClient(fakeRT)
-	got, _ := client.UpdateDevice(Params{"iden": "0xyz", "nickname": "bar"})
+	got, _ := client.UpdateDevice(context.Background(), Params{"iden": "0xyz", "nickname": "bar"})
 	if !reflect.DeepEqual(got, expected) {
 		t.Errorf("Error, expected %#v, got %#v", expected, got)
 	}
@@ -382,7 +385,7 @@ func TestUpdateDevice(t *testing.T) {
 
 func TestDeleteDeviceError(t *testing.T) {
 	client := Client{}
-	err := client.DeleteDevice(Params{})
+	err := client.DeleteDevice(context.Background(), Params{})
 	if err != noIdenError {
 		t.Errorf("Expected %#v, got %#v", noIdenError, err)
 	}
@@ -391,7 +394,7 @@ func TestDeleteDeviceError(t *testing.T) {
 func TestDeleteDevice(t *testing.T) {
 	fakeRT := &FakeRoundTripper{message: "", status: http.StatusOK}
 	client := newTestClient(fakeRT)
-	err := client.DeleteDevice(Params{"iden": "0xyz"})
+	err := client.DeleteDevice(context.Background(), Params{"iden": "0xyz"})
 	if err != nil {
 		t.Errorf("Error, expected nil, got %#v", err)
 	}
@@ -424,11 +427,11 @@ func TestGetPushes(t *testing.T) {
 	var expected Pushes
 	err := json.Unmarshal([]byte(body), &expected)
 	if err != nil {
-		t.Errorf("Error unmarshaling JSON", err)
+		t.Errorf("Error unmarshaling JSON: %v", err)
 	}
 	fakeRT := &FakeRoundTripper{message: body, status: http.StatusOK}
 	client := newTestClient(fakeRT)
-	got, _ := client.GetPushes()
+	got, _ := client.GetPushes(context.Background(), nil)
 	if !reflect.DeepEqual(got, expected.Pushes) {
 		t.Errorf("Error, expected %#v, got %#v", expected, got)
 	}
@@ -436,27 +439,27 @@ func TestGetPushes(t *testing.T) {
 
 func TestCreatePushError(t *testing.T) {
 	client := Client{}
-	_, err := client.CreatePush(Params{})
+	_, err := client.CreatePush(context.Background(), Params{})
 	if err != pushNoTypeError {
 		t.Errorf("Expected %#v, got %#v", pushNoTypeError, err)
 	}
-	_, err = client.CreatePush(Params{"type": "link"})
+	_, err = client.CreatePush(context.Background(), Params{"type": "link"})
 	if err != pushNoLinkError {
 		t.Errorf("Expected %#v, got %#v", pushNoLinkError, err)
 	}
-	_, err = client.CreatePush(Params{"type": "address"})
+	_, err = client.CreatePush(context.Background(), Params{"type": "address"})
 	if err != pushNoAddressError {
 		t.Errorf("Expected %#v, got %#v", pushNoAddressError, err)
 	}
-	_, err = client.CreatePush(Params{"type": "list"})
+	_, err = client.CreatePush(context.Background(), Params{"type": "list"})
 	if err != pushNoItemsError {
 		t.Errorf("Expected %#v, got %#v", pushNoItemsError, err)
 	}
-	_, err = client.CreatePush(Params{"type": "file"})
+	_, err = client.CreatePush(context.Background(), Params{"type": "file"})
 	if err != pushNoFileNameError {
 		t.Errorf("Expected %#v, got %#v", pushNoFileNameError, err)
 	}
-	_, err = client.CreatePush(Params{"type": "file", "file_name": "foo.txt"})
+	_, err = client.CreatePush(context.Background(), Params{"type": "file", "file_name": "foo.txt"})
 	if err != pushNoFileTypeError {
 		t.Errorf("Expected %#v, got %#v", pushNoFileTypeError, err)
 	}
@@ -484,11 +487,11 @@ func TestCreatePushNote(t *testing.T) {
 	var expected Push
 	err := json.Unmarshal([]byte(body), &expected)
 	if err != nil {
-		t.Errorf("Error unmarshaling JSON", err)
+		t.Errorf("Error unmarshaling JSON: %v", err)
 	}
 	fakeRT := &FakeRoundTripper{message: body, status: http.StatusOK}
 	client := newTestClient(fakeRT)
-	got, _ := client.CreatePush(Params{"type": "note"})
+	got, _ := client.CreatePush(context.Background(), Params{"type": "note"})
 	if !reflect.DeepEqual(got, expected) {
 		t.Errorf("Expected %#v, got %#v", expected, got)
 	}
@@ -519,11 +522,11 @@ func TestCreatePushList(t *testing.T) {
 	var expected Push
 	err := json.Unmarshal([]byte(body), &expected)
 	if err != nil {
-		t.Errorf("Error unmarshaling JSON", err)
+		t.Errorf("Error unmarshaling JSON: %v", err)
 	}
 	fakeRT := &FakeRoundTripper{message: body, status: http.StatusOK}
 	client := newTestClient(fakeRT)
-	got, _ := client.CreatePush(Params{"type": "list",
+	got, _ := client.CreatePush(context.Background(), Params{"type": "list",
 		"title": "foo",
 		"items": []string{"foo"}})
 	if !reflect.DeepEqual(got, expected) {
@@ -541,7 +544,24 @@ func TestCreatePushList(t *testing.T) {
 }
 
 func TestCreatePushLink(t *testing.T) {
-
+	body := `
+	{
+	  "iden": "ubdprOsjAhOzf0XYq",
+	  "type": "link",
+	  "title": "Pushbullet",
+	  "url": "http://docs.pushbullet.com",
+	  "active": true
+	}
+  `
+	fakeRT := &FakeRoundTripper{message: body, status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	got, err := client.CreatePush(context.Background(), Params{"type": "link", "url": "http://docs.pushbullet.com"})
+	if err != nil {
+		t.Errorf("Expected no error, got %#v", err)
+	}
+	if got.Url != "http://docs.pushbullet.com" {
+		t.Errorf("Got %#v, expected http://docs.pushbullet.com", got.Url)
+	}
 }
 
 func TestCreatePushFile(t *testing.T) {
@@ -550,7 +570,7 @@ func TestCreatePushFile(t *testing.T) {
 
 func TestUpdatePushError(t *testing.T) {
 	client := Client{}
-	_, err := client.UpdatePush(Params{})
+	_, err := client.UpdatePush(context.Background(), Params{})
 	if err != noIdenError {
 		t.Errorf("Expected %#v, got %#v", noIdenError, err)
 	}
@@ -582,7 +602,7 @@ func TestUpdatePush(t *testing.T) {
 	}
 	fakeRT := &FakeRoundTripper{message: body, status: http.StatusOK}
 	client := newTestClient(fakeRT)
-	got, _ := client.UpdatePush(Params{"iden": "0xyz", "title": "foobaz"})
+	got, _ := client.UpdatePush(context.Background(), Params{"iden": "0xyz", "title": "foobaz"})
 	if !reflect.DeepEqual(got, expected) {
 		t.Errorf("Error, expected %#v, got %#v", expected, got)
 	}
@@ -590,7 +610,7 @@ func TestUpdatePush(t *testing.T) {
 
 func TestDeletePushError(t *testing.T) {
 	client := Client{}
-	err := client.DeletePush(Params{})
+	err := client.DeletePush(context.Background(), Params{})
 	if err != noIdenError {
 		t.Errorf("Expected %#v, got %#v", noIdenError, err)
 	}
@@ -599,7 +619,7 @@ func TestDeletePushError(t *testing.T) {
 func TestDeletePush(t *testing.T) {
 	fakeRT := &FakeRoundTripper{message: "", status: http.StatusOK}
 	client := newTestClient(fakeRT)
-	err := client.DeletePush(Params{"iden": "0xyz"})
+	err := client.DeletePush(context.Background(), Params{"iden": "0xyz"})
 	if err != nil {
 		t.Errorf("Error, expected nil, got %#v", err)
 	}
@@ -608,3 +628,252 @@ func TestDeletePush(t *testing.T) {
 func TestUploadRequestError(t *testing.T) {
 
 }
+
+type sequenceRoundTripper struct {
+	statuses []int
+	header   map[string]string
+	requests []*http.Request
+}
+
+func (rt *sequenceRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	status := rt.statuses[0]
+	if len(rt.statuses) > 1 {
+		rt.statuses = rt.statuses[1:]
+	}
+	rt.requests = append(rt.requests, r)
+	res := &http.Response{
+		StatusCode: status,
+		Body:       ioutil.NopCloser(strings.NewReader(`{"iden": "foo"}`)),
+		Header:     make(http.Header),
+	}
+	for k, v := range rt.header {
+		res.Header.Set(k, v)
+	}
+	return res, nil
+}
+
+// Makes retries wait a millisecond until the end of the test.
+func fastRetries(t *testing.T) {
+	backoff := retryBackoff
+	retryBackoff = time.Millisecond
+	t.Cleanup(func() {
+		retryBackoff = backoff
+	})
+}
+
+func TestDo(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: `{"blocks": [{"iden": "0xyz"}]}`, status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	client.BaseURL = "http://localhost:8080/v2"
+	var resp struct {
+		Blocks []struct {
+			Iden string `json:"iden"`
+		} `json:"blocks"`
+	}
+	err := client.Do(context.Background(), "POST", "/v2/blocks", Params{"email": "foo@bar.com"}, &resp)
+	if err != nil {
+		t.Fatalf("Expected no error, got %#v", err)
+	}
+	if len(resp.Blocks) != 1 || resp.Blocks[0].Iden != "0xyz" {
+		t.Errorf("Unexpected response %#v", resp)
+	}
+	req := fakeRT.requests[0]
+	if req.URL.String() != "http://localhost:8080/v2/blocks" {
+		t.Errorf("Expected http://localhost:8080/v2/blocks, got %s", req.URL)
+	}
+	if user, _, ok := req.BasicAuth(); !ok || user != "foobar" {
+		t.Errorf("Expected basic auth with token, got %#v", req.Header)
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if string(body) != `{"email":"foo@bar.com"}` {
+		t.Errorf("Unexpected body %s", body)
+	}
+}
+
+func TestDoHttpError(t *testing.T) {
+	body := `{"error": {"type": "invalid_request", "message": "The resource could not be found.", "cite": "https://docs.pushbullet.com"}}`
+	fakeRT := &FakeRoundTripper{message: body, status: http.StatusNotFound}
+	client := newTestClient(fakeRT)
+	err := client.Do(context.Background(), "GET", "blocks", nil, nil)
+	httpErr, ok := err.(*HttpError)
+	if !ok {
+		t.Fatalf("Expected *HttpError, got %#v", err)
+	}
+	if httpErr.Status != http.StatusNotFound || httpErr.Type != "invalid_request" || httpErr.Message != "The resource could not be found." {
+		t.Errorf("Unexpected error %#v", httpErr)
+	}
+
+	fakeRT = &FakeRoundTripper{message: "", status: http.StatusBadGateway}
+	client = newTestClient(fakeRT)
+	err = client.Do(context.Background(), "GET", "blocks", nil, nil)
+	if httpErr, ok := err.(*HttpError); !ok || httpErr.Message != "Bad Gateway" {
+		t.Errorf("Expected Bad Gateway, got %#v", err)
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	tests := []struct {
+		err          error
+		permanent    bool
+		unauthorized bool
+	}{
+		{&HttpError{Status: http.StatusBadRequest}, true, false},
+		{fmt.Errorf("wrapped: %w", &HttpError{Status: http.StatusNotFound}), true, false},
+		{&HttpError{Status: http.StatusUnauthorized}, true, true},
+		{&HttpError{Status: http.StatusForbidden}, true, true},
+		{&HttpError{Status: http.StatusTooManyRequests}, false, false},
+		{&HttpError{Status: http.StatusBadGateway}, false, false},
+		{context.DeadlineExceeded, false, false},
+		{nil, false, false},
+	}
+	for _, test := range tests {
+		if IsPermanent(test.err) != test.permanent || IsUnauthorized(test.err) != test.unauthorized {
+			t.Errorf("Expected %v permanent %v, unauthorized %v", test.err, test.permanent, test.unauthorized)
+		}
+	}
+}
+
+func TestDoRetry(t *testing.T) {
+	fastRetries(t)
+	fakeRT := &sequenceRoundTripper{statuses: []int{500, 503, 200}}
+	client := newTestClient(fakeRT)
+	client.MaxRetries = 3
+	if err := client.Do(context.Background(), "GET", "blocks", nil, nil); err != nil {
+		t.Errorf("Expected no error, got %#v", err)
+	}
+	if len(fakeRT.requests) != 3 {
+		t.Errorf("Expected 3 requests, got %d", len(fakeRT.requests))
+	}
+
+	fakeRT = &sequenceRoundTripper{statuses: []int{500, 200}}
+	client = newTestClient(fakeRT)
+	client.MaxRetries = 3
+	if err := client.Do(context.Background(), "POST", "blocks", Params{}, nil); err == nil {
+		t.Errorf("Expected error for non idempotent request")
+	}
+	if len(fakeRT.requests) != 1 {
+		t.Errorf("Expected 1 request, got %d", len(fakeRT.requests))
+	}
+
+	fakeRT = &sequenceRoundTripper{statuses: []int{500}}
+	client = newTestClient(fakeRT)
+	client.MaxRetries = 2
+	if err := client.Do(context.Background(), "GET", "blocks", nil, nil); err == nil {
+		t.Errorf("Expected error after retries")
+	}
+	if len(fakeRT.requests) != 3 {
+		t.Errorf("Expected 3 requests, got %d", len(fakeRT.requests))
+	}
+}
+
+func TestDoRateLimit(t *testing.T) {
+	fastRetries(t)
+	fakeRT := &sequenceRoundTripper{
+		statuses: []int{http.StatusTooManyRequests, 200},
+		header: map[string]string{
+			"X-Ratelimit-Limit":     "16384",
+			"X-Ratelimit-Remaining": "0",
+			"X-Ratelimit-Reset":     "1",
+		},
+	}
+	client := newTestClient(fakeRT)
+	if client.RateLimit().Remaining != -1 {
+		t.Errorf("Expected unknown rate limit, got %#v", client.RateLimit())
+	}
+	client.MaxRetries = 1
+	if err := client.Do(context.Background(), "POST", "pushes", Params{}, nil); err != nil {
+		t.Errorf("Expected rate limited POST to be retried, got %#v", err)
+	}
+	rateLimit := client.RateLimit()
+	if rateLimit.Limit != 16384 || rateLimit.Remaining != 0 || rateLimit.Reset.Unix() != 1 {
+		t.Errorf("Unexpected rate limit %#v", rateLimit)
+	}
+}
+
+func TestGetChats(t *testing.T) {
+	body := `
+	{
+	  "chats": [
+	  {
+	    "active": true,
+	    "created": 1412047948.579029,
+	    "iden": "ujpah72o0sjAoRtnM0jc",
+	    "modified": 1412047948.579031,
+	    "with": {
+	      "email": "carmack@idsoftware.com",
+	      "email_normalized": "carmack@idsoftware.com",
+	      "iden": "ujlMns72k",
+	      "image_url": "https://lh3.googleusercontent.com/-Y7ZHnCH9y1I/AAAAAAAAAAI/AAAAAAAAAAA/aHG4LbgPj8g/photo.jpg",
+	      "name": "John Carmack",
+	      "type": "user"
+	    }
+	  }
+	  ]
+	}
+	`
+	var expected Chats
+	err := json.Unmarshal([]byte(body), &expected)
+	if err != nil {
+		t.Errorf("Error unmarshaling JSON")
+	}
+	fakeRT := &FakeRoundTripper{message: body, status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	got, _ := client.GetChats(context.Background())
+	if !reflect.DeepEqual(got, expected.Chats) {
+		t.Errorf("Error, expected %#v, got %#v", expected, got)
+	}
+	if got[0].With.Email != "carmack@idsoftware.com" {
+		t.Errorf("Expected chat with carmack@idsoftware.com, got %#v", got[0].With)
+	}
+}
+
+func TestCreateChatError(t *testing.T) {
+	client := Client{}
+	_, err := client.CreateChat(context.Background(), Params{})
+	if err.Error() != "no email has been given" {
+		t.Errorf("Error, expected no email has been given, got %#v", err)
+	}
+}
+
+func TestDeleteAllPushes(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "{}", status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	err := client.DeleteAllPushes(context.Background())
+	if err != nil {
+		t.Errorf("Error, expected nil, got %#v", err)
+	}
+	req := fakeRT.requests[0]
+	if req.Method != "DELETE" || req.URL.Path != "/v2/pushes" {
+		t.Errorf("Expected DELETE /v2/pushes, got %s %s", req.Method, req.URL.Path)
+	}
+}
+
+func TestPushEphemeral(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "{}", status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	client.device = "dev1"
+	push := Params{"type": "clip", "body": "foo"}
+	if err := client.PushEphemeral(context.Background(), push); err != nil {
+		t.Errorf("Error, expected nil, got %#v", err)
+	}
+	req := fakeRT.requests[0]
+	if req.Method != "POST" || req.URL.Path != "/v2/ephemerals" {
+		t.Errorf("Expected POST /v2/ephemerals, got %s %s", req.Method, req.URL.Path)
+	}
+	if push["source_device_iden"] != "dev1" {
+		t.Errorf("Expected source_device_iden dev1, got %#v", push["source_device_iden"])
+	}
+	if err := client.PushEphemeral(context.Background(), Params{}); err != pushNoTypeError {
+		t.Errorf("Expected pushNoTypeError, got %#v", err)
+	}
+}
+
+func TestTime(t *testing.T) {
+	created := Time(1411595135.9686127)
+	if created.Unix() != 1411595135 || created.Nanosecond()/int(time.Millisecond) != 968 {
+		t.Errorf("Unexpected time %v", created)
+	}
+	if ts := Timestamp(created); ts < 1411595135.968 || ts > 1411595135.969 {
+		t.Errorf("Expected the timestamp back, got %v", ts)
+	}
+}
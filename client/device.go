@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Identity of the device of the program, as stored in Client.DeviceFile.
+type deviceIdentity struct {
+	Iden     string `json:"iden"`
+	Nickname string `json:"nickname"`
+	Icon     string `json:"icon"`
+	Model    string `json:"model"`
+}
+
+// Find or create the device of the program.
+// See: https://docs.pushbullet.com/#devices
+//
+// Usage:
+//
+//	device, err := client.EnsureDevice(ctx, "backup server", "system", "backupd")
+//
+// The iden of the device is kept in DeviceFile, so the same device is used
+// on every start. By default the file is named after the model, so
+// programs sharing a user config directory keep their own devices and a new
+// nickname renames the device of the program. A stored iden is only used if its device has the same model:
+// otherwise, or if the file is missing, an active device with the same
+// nickname and model is adopted before creating a new one. A device whose
+// nickname or icon differ from the arguments, such as one renamed in an
+// app, is updated. icon is one of the device icons of the API, such as
+// "system" or "desktop", and is also the type of a created device.
+//
+// Once the device is known, pushes created by the client have it as their
+// source_device_iden and Stream skips ephemerals sent from it.
+func (c *Client) EnsureDevice(ctx context.Context, nickname, icon, model string, opts ...RequestOption) (Device, error) {
+	path, err := c.deviceFile(model)
+	if err != nil {
+		return Device{}, err
+	}
+	var id deviceIdentity
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &id); err != nil {
+			return Device{}, fmt.Errorf("reading %s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return Device{}, err
+	}
+
+	devices, err := c.GetDevices(ctx, opts...)
+	if err != nil {
+		return Device{}, err
+	}
+	device, found := findDevice(devices, id.Iden, nickname, model)
+	switch {
+	case !found:
+		device, err = c.CreateDevice(ctx, Params{"nickname": nickname, "type": icon, "icon": icon, "model": model}, opts...)
+	case device.Nickname != nickname || device.Icon != icon || device.Model != model:
+		device, err = c.UpdateDevice(ctx, Params{"iden": device.Iden, "nickname": nickname, "icon": icon, "model": model}, opts...)
+	}
+	if err != nil {
+		return Device{}, err
+	}
+
+	id = deviceIdentity{Iden: device.Iden, Nickname: nickname, Icon: icon, Model: model}
+	data, err := json.MarshalIndent(id, "", "  ")
+	if err != nil {
+		return Device{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return Device{}, err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return Device{}, err
+	}
+	c.mu.Lock()
+	c.device = device.Iden
+	c.mu.Unlock()
+	return device, nil
+}
+
+// DeviceIden returns the iden of the device set up by EnsureDevice, "" if
+// it was not called.
+func (c *Client) DeviceIden() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.device
+}
+
+// Returns the active device with iden and model or, failing that, the only
+// one with nickname and model. A device of another model belongs to another
+// program.
+func findDevice(devices []Device, iden, nickname, model string) (Device, bool) {
+	var matches []Device
+	for _, device := range devices {
+		if !device.Active || device.Model != model {
+			continue
+		}
+		if iden != "" && device.Iden == iden {
+			return device, true
+		}
+		if device.Nickname == nickname {
+			matches = append(matches, device)
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], true
+	}
+	return Device{}, false
+}
+
+func (c *Client) deviceFile(model string) (string, error) {
+	if c.DeviceFile != "" {
+		return c.DeviceFile, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	// SanitizeFileName keeps what follows the last slash.
+	name := SanitizeFileName(strings.NewReplacer("/", "_", "\\", "_").Replace(model))
+	if name == "" {
+		name = "device"
+	}
+	return filepath.Join(dir, "pushbullet", "devices", name+".json"), nil
+}
@@ -0,0 +1,134 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeDevices serves the devices endpoints.
+type fakeDevices struct {
+	devices []Device
+	created int
+	updated int
+}
+
+func (f *fakeDevices) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var params Params
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&params)
+	}
+	switch {
+	case r.Method == "GET":
+		json.NewEncoder(w).Encode(Devices{Devices: f.devices})
+	case strings.HasSuffix(r.URL.Path, "/devices"):
+		f.created++
+		device := Device{Iden: fmt.Sprintf("dev%d", len(f.devices)), Active: true, Nickname: params["nickname"].(string),
+			Icon: params["icon"].(string), Model: params["model"].(string)}
+		f.devices = append(f.devices, device)
+		json.NewEncoder(w).Encode(device)
+	default:
+		f.updated++
+		iden := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		for i := range f.devices {
+			if f.devices[i].Iden == iden {
+				f.devices[i].Nickname = params["nickname"].(string)
+				json.NewEncoder(w).Encode(f.devices[i])
+			}
+		}
+	}
+}
+
+func TestEnsureDevice(t *testing.T) {
+	fake := &fakeDevices{devices: []Device{{Iden: "phone", Active: true, Nickname: "Pixel"}}}
+	file := filepath.Join(t.TempDir(), "device.json")
+	newClient := func() *Client {
+		client := newTestClient(&handlerRoundTripper{handler: fake})
+		client.DeviceFile = file
+		return client
+	}
+	ctx := context.Background()
+
+	client := newClient()
+	device, err := client.EnsureDevice(ctx, "backup server", "system", "backupd")
+	if err != nil || device.Iden != "dev1" || fake.created != 1 {
+		t.Fatalf("Expected device to be created, got %#v, %v", device, err)
+	}
+	if client.DeviceIden() != "dev1" {
+		t.Errorf("Expected client device dev1, got %q", client.DeviceIden())
+	}
+
+	// A restart reuses the device, and updates it if the nickname changed.
+	device, err = newClient().EnsureDevice(ctx, "backup server", "system", "backupd")
+	if err != nil || device.Iden != "dev1" || fake.created != 1 || fake.updated != 0 {
+		t.Errorf("Expected device to be reused, got %#v, %v", device, err)
+	}
+	device, err = newClient().EnsureDevice(ctx, "nightly backups", "system", "backupd")
+	if err != nil || device.Iden != "dev1" || device.Nickname != "nightly backups" || fake.updated != 1 {
+		t.Errorf("Expected device to be updated, got %#v, %v", device, err)
+	}
+
+	// Without identity file, the device is found by nickname and model.
+	client = newTestClient(&handlerRoundTripper{handler: fake})
+	client.DeviceFile = filepath.Join(t.TempDir(), "device.json")
+	device, err = client.EnsureDevice(ctx, "nightly backups", "system", "backupd")
+	if err != nil || device.Iden != "dev1" || fake.created != 1 {
+		t.Errorf("Expected device to be adopted, got %#v, %v", device, err)
+	}
+}
+
+func TestEnsureDeviceOtherProgram(t *testing.T) {
+	fake := &fakeDevices{}
+	ctx := context.Background()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	// By default every program keeps its own identity file.
+	agent, err := newTestClient(&handlerRoundTripper{handler: fake}).EnsureDevice(ctx, "web01", "system", "pb agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox, err := newTestClient(&handlerRoundTripper{handler: fake}).EnsureDevice(ctx, "web01 inbox", "system", "pb inbox")
+	if err != nil || inbox.Iden == agent.Iden {
+		t.Fatalf("Expected a device per program, got %#v, %v", inbox, err)
+	}
+	device, err := newTestClient(&handlerRoundTripper{handler: fake}).EnsureDevice(ctx, "web01", "system", "pb agent")
+	if err != nil || device.Iden != agent.Iden || fake.created != 2 || fake.updated != 0 {
+		t.Errorf("Expected the agent device to be reused, got %#v, %v", device, err)
+	}
+
+	// A new nickname renames the device.
+	device, err = newTestClient(&handlerRoundTripper{handler: fake}).EnsureDevice(ctx, "web01 agent", "system", "pb agent")
+	if err != nil || device.Iden != agent.Iden || device.Nickname != "web01 agent" || fake.created != 2 || fake.updated != 1 {
+		t.Errorf("Expected the agent device to be renamed, got %#v, %v", device, err)
+	}
+
+	// A shared file pointing to the device of another model is ignored.
+	client := newTestClient(&handlerRoundTripper{handler: fake})
+	client.DeviceFile = filepath.Join(t.TempDir(), "device.json")
+	os.WriteFile(client.DeviceFile, []byte(`{"iden": "`+agent.Iden+`"}`), 0600)
+	device, err = client.EnsureDevice(ctx, "web01 inbox", "system", "pb inbox")
+	if err != nil || device.Iden != inbox.Iden || fake.updated != 1 {
+		t.Errorf("Expected the inbox device without renaming the agent one, got %#v, %v", device, err)
+	}
+}
+
+func TestCreatePushSourceDevice(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "{}", status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	client.device = "dev1"
+	client.CreatePush(context.Background(), Params{"type": "note"})
+	client.CreatePush(context.Background(), Params{"type": "note", "source_device_iden": "other"})
+	sent := sentParams(fakeRT)
+	if sent[0]["source_device_iden"] != "dev1" {
+		t.Errorf("Expected source_device_iden dev1, got %#v", sent[0]["source_device_iden"])
+	}
+	if sent[1]["source_device_iden"] != "other" {
+		t.Errorf("Expected explicit source_device_iden to be kept, got %#v", sent[1]["source_device_iden"])
+	}
+}
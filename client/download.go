@@ -0,0 +1,243 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	noFileUrlError        = errors.New("No file url for push")
+	checksumMismatchError = errors.New("Checksum mismatch")
+)
+
+// Download the file of a file push into dir.
+// See: https://docs.pushbullet.com/#upload-request
+//
+// Usage:
+//
+//	path, err := client.DownloadFile(ctx, push, "downloads", client.WithSHA256("9f86d08..."))
+//
+// The file is named after the sanitized file_name of the push, with a
+// " (n)" suffix if that name is taken, and the path is returned. It is
+// written to a ".part" file first and only renamed once complete: its size
+// checked against the one announced by the server, and its SHA-256 against
+// the one given by WithSHA256. Interrupted downloads are resumed with a
+// range request, by retries or by a later call for the same push.
+//
+// Encrypted files are not supported.
+func (c *Client) DownloadFile(ctx context.Context, push Push, dir string, opts ...RequestOption) (path string, err error) {
+	if push.FileUrl == "" {
+		return "", noFileUrlError
+	}
+	ctx, cancel := withRequestOptions(ctx, opts)
+	defer cancel()
+	ctx, done := c.observe(ctx, "DownloadFile")
+	call := Call{Operation: "DownloadFile", Method: "GET", Endpoint: push.FileUrl, RateLimitRemaining: -1}
+	start := time.Now()
+	defer func() {
+		call.Duration = time.Since(start)
+		call.Err = err
+		done(call)
+	}()
+
+	name := SanitizeFileName(push.FileName)
+	if name == "" {
+		name = SanitizeFileName(filepath.Base(strings.SplitN(push.FileUrl, "?", 2)[0]))
+	}
+	if name == "" {
+		name = "file"
+	}
+	// Named after the push, so that a later call resumes it.
+	key := SanitizeFileName(push.Iden)
+	if key == "" {
+		key = name
+	}
+	part := filepath.Join(dir, ".download-"+key+".part")
+	defer func() {
+		// Nothing to resume.
+		if info, statErr := os.Stat(part); err != nil && statErr == nil && info.Size() == 0 {
+			os.Remove(part)
+		}
+	}()
+	log := c.logger().With("method", "GET", "endpoint", push.FileUrl, "file_name", name)
+	for attempt := 0; ; attempt++ {
+		var n int64
+		n, err = c.download(ctx, push.FileUrl, part, &call)
+		call.BytesDownloaded += n
+		if err == nil {
+			break
+		}
+		log.Debug("pushbullet download failed", "attempt", attempt, "error", err)
+		if errors.Is(err, checksumMismatchError) {
+			return "", err
+		}
+		wait, ok := c.retryWait(ctx, true, attempt, err)
+		if !ok {
+			return "", err
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return "", err
+		}
+	}
+	if sum := requestConfigFrom(ctx).sha256; sum != "" {
+		if err := verifySHA256(part, sum); err != nil {
+			os.Remove(part)
+			return "", err
+		}
+	}
+	return renameFree(part, filepath.Join(dir, name))
+}
+
+// Downloads url into part, resuming from its current size. Returns the
+// number of bytes received.
+func (c *Client) download(ctx context.Context, url, part string, call *Call) (int64, error) {
+	file, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	call.Status = resp.StatusCode
+
+	size := int64(-1)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// The server ignored the range: start over.
+		if offset, err = file.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if err := file.Truncate(0); err != nil {
+			return 0, err
+		}
+		size = resp.ContentLength
+	case http.StatusPartialContent:
+		var first int64
+		first, size = contentRange(resp.Header.Get("Content-Range"))
+		if first != offset {
+			file.Truncate(0)
+			return 0, fmt.Errorf("Unexpected range %q", resp.Header.Get("Content-Range"))
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The part is complete if it is as long as the file.
+		if _, size = contentRange(resp.Header.Get("Content-Range")); size == offset {
+			return 0, nil
+		}
+		file.Truncate(0)
+		return 0, fmt.Errorf("Unexpected range %q", resp.Header.Get("Content-Range"))
+	default:
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		return 0, newHttpError(resp.StatusCode, data)
+	}
+	n, err := io.Copy(file, resp.Body)
+	if err != nil {
+		return n, err
+	}
+	if err := file.Sync(); err != nil {
+		return n, err
+	}
+	if size >= 0 && offset+n != size {
+		if offset+n > size {
+			file.Truncate(0)
+		}
+		return n, fmt.Errorf("Downloaded %d of %d bytes: %w", offset+n, size, io.ErrUnexpectedEOF)
+	}
+	return n, nil
+}
+
+// Parses a Content-Range header, "bytes 100-199/1000" or "bytes */1000",
+// into the first byte and the total size, -1 if unknown.
+func contentRange(header string) (first, size int64) {
+	first, size = -1, -1
+	spec, total, ok := strings.Cut(strings.TrimPrefix(header, "bytes "), "/")
+	if !ok {
+		return first, size
+	}
+	if n, err := strconv.ParseInt(total, 10, 64); err == nil {
+		size = n
+	}
+	if start, _, ok := strings.Cut(spec, "-"); ok {
+		if n, err := strconv.ParseInt(start, 10, 64); err == nil {
+			first = n
+		}
+	}
+	return first, size
+}
+
+func verifySHA256(path, sum string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, sum) {
+		return fmt.Errorf("%w: got sha256 %s, want %s", checksumMismatchError, got, sum)
+	}
+	return nil
+}
+
+// Renames from to path, or to "name (n).ext" next to it if path exists.
+func renameFree(from, path string) (string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 1; ; n++ {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			return path, os.Rename(from, path)
+		}
+		path = fmt.Sprintf("%s (%d)%s", base, n, ext)
+	}
+}
+
+// SanitizeFileName reduces a file name chosen by the sender of a push to a
+// safe base name: no directories, control characters or leading dots, at
+// most 255 bytes. Returns "" if nothing is left.
+func SanitizeFileName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	name = strings.TrimRight(name, ". ")
+	for len(name) > 255 {
+		ext := filepath.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		r := []rune(strings.TrimSuffix(name, ext))
+		name = string(r[:len(r)-1]) + ext
+	}
+	return name
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var fileContent = bytes.Repeat([]byte("pushbullet"), 1000)
+
+func newFileServer(t *testing.T) (*httptest.Server, *[]string) {
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "report.txt", time.Time{}, bytes.NewReader(fileContent))
+	}))
+	t.Cleanup(server.Close)
+	return server, &ranges
+}
+
+func TestDownloadFile(t *testing.T) {
+	server, _ := newFileServer(t)
+	client := newTestClient(http.DefaultTransport)
+	dir := t.TempDir()
+	sum := sha256.Sum256(fileContent)
+	push := Push{Iden: "0xyz", FileName: "../../etc/report.txt", FileUrl: server.URL + "/report.txt"}
+	path, err := client.DownloadFile(context.Background(), push, dir, WithSHA256(hex.EncodeToString(sum[:])))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if path != filepath.Join(dir, "report.txt") {
+		t.Errorf("Expected sanitized path, got %s", path)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, fileContent) {
+		t.Errorf("Unexpected content of %d bytes", len(data))
+	}
+	path, err = client.DownloadFile(context.Background(), push, dir)
+	if err != nil || path != filepath.Join(dir, "report (1).txt") {
+		t.Errorf("Expected a free name, got %s, %v", path, err)
+	}
+}
+
+func TestDownloadFileResume(t *testing.T) {
+	server, ranges := newFileServer(t)
+	client := newTestClient(http.DefaultTransport)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, ".download-0xyz.part"), fileContent[:4000], 0600)
+	push := Push{Iden: "0xyz", FileName: "report.txt", FileUrl: server.URL + "/report.txt"}
+	path, err := client.DownloadFile(context.Background(), push, dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, fileContent) {
+		t.Errorf("Unexpected content of %d bytes", len(data))
+	}
+	if len(*ranges) != 1 || (*ranges)[0] != "bytes=4000-" {
+		t.Errorf("Expected a range request, got %q", *ranges)
+	}
+}
+
+func TestDownloadFileChecksum(t *testing.T) {
+	server, _ := newFileServer(t)
+	client := newTestClient(http.DefaultTransport)
+	dir := t.TempDir()
+	push := Push{Iden: "0xyz", FileName: "report.txt", FileUrl: server.URL + "/report.txt"}
+	_, err := client.DownloadFile(context.Background(), push, dir, WithSHA256(strings.Repeat("0", 64)))
+	if !errors.Is(err, checksumMismatchError) {
+		t.Errorf("Expected checksum mismatch, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected no files left, got %v", entries)
+	}
+}
+
+func TestDownloadFileUnexpectedIden(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	client := newTestClient(http.DefaultTransport)
+	base := t.TempDir()
+	dir := filepath.Join(base, "downloads")
+	os.Mkdir(dir, 0700)
+	push := Push{Iden: "/../../0xyz", FileName: "report.txt", FileUrl: server.URL + "/report.txt"}
+	if _, err := client.DownloadFile(context.Background(), push, dir); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if entries, _ := os.ReadDir(base); len(entries) != 1 {
+		t.Errorf("Expected nothing written outside of dir, got %v", entries)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected no empty part left, got %v", entries)
+	}
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := map[string]string{
+		"report.txt":           "report.txt",
+		`C:\Users\me\evil.exe`: "evil.exe",
+		"../../.bashrc":        "bashrc",
+		"a\x00b<c>.txt":        "a_b_c_.txt",
+		"..":                   "",
+		"name. ":               "name",
+	}
+	for name, want := range tests {
+		if got := SanitizeFileName(name); got != want {
+			t.Errorf("SanitizeFileName(%q) = %q, want %q", name, got, want)
+		}
+	}
+	if got := SanitizeFileName(strings.Repeat("x", 300) + ".txt"); len(got) != 255 || !strings.HasSuffix(got, ".txt") {
+		t.Errorf("Expected name truncated to 255 bytes, got %d bytes", len(got))
+	}
+}
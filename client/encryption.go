@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+var (
+	noEncryptionKeyError = errors.New("No encryption password")
+	decryptionError      = errors.New("Cannot decrypt message")
+)
+
+// Parameters of the end-to-end encryption of the API.
+// See: https://docs.pushbullet.com/#end-to-end-encryption
+const (
+	keyIterations = 30000
+	ivSize        = 12
+	tagSize       = 16
+	cipherVersion = "1"
+)
+
+// WithEncryption sets whether PushEphemeral encrypts the ephemeral, by
+// default whenever the client has an encryption password. Encrypting
+// without a password fails with noEncryptionKeyError.
+func WithEncryption(enabled bool) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.encryption = &enabled
+	}
+}
+
+// Set the end-to-end encryption password of the account.
+// See: https://docs.pushbullet.com/#end-to-end-encryption
+//
+// Usage:
+//
+//	err := client.SetEncryptionPassword(ctx, "hunter2")
+//
+// The key is derived from the password and the iden of the user, fetched
+// with GetMe. Ephemerals are then encrypted by PushEphemeral, unless
+// WithEncryption(false) is given, and decrypted by Stream. Pushes are never
+// encrypted: the API only supports encryption of ephemerals. An empty
+// password disables encryption.
+func (c *Client) SetEncryptionPassword(ctx context.Context, password string, opts ...RequestOption) error {
+	if password == "" {
+		c.mu.Lock()
+		c.encryptionKey = nil
+		c.mu.Unlock()
+		return nil
+	}
+	user, err := c.GetMe(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, []byte(user.Iden), keyIterations, 32)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.encryptionKey = key
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Client) key() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.encryptionKey
+}
+
+// Returns the encrypted form of the ephemeral push.
+func encrypt(key []byte, push Params) (Params, error) {
+	plaintext, err := json.Marshal(push)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, ivSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	// Seal appends the tag to the ciphertext; the API puts it first.
+	sealed := gcm.Seal(nil, iv, plaintext, nil)
+	ciphertext, tag := sealed[:len(sealed)-tagSize], sealed[len(sealed)-tagSize:]
+	message := append([]byte(cipherVersion), tag...)
+	message = append(message, iv...)
+	message = append(message, ciphertext...)
+	return Params{"encrypted": true, "ciphertext": base64.StdEncoding.EncodeToString(message)}, nil
+}
+
+// Returns the decrypted push of msg if it is an encrypted ephemeral.
+func (c *Client) decrypt(msg StreamMessage) (StreamMessage, error) {
+	if msg.Type != "push" {
+		return msg, nil
+	}
+	var push struct {
+		Encrypted  bool   `json:"encrypted"`
+		Ciphertext string `json:"ciphertext"`
+	}
+	if json.Unmarshal(msg.Push, &push) != nil || !push.Encrypted {
+		return msg, nil
+	}
+	key := c.key()
+	if key == nil {
+		return msg, noEncryptionKeyError
+	}
+	message, err := base64.StdEncoding.DecodeString(push.Ciphertext)
+	if err != nil || len(message) < 1+tagSize+ivSize || string(message[:1]) != cipherVersion {
+		return msg, decryptionError
+	}
+	tag := message[1 : 1+tagSize]
+	iv := message[1+tagSize : 1+tagSize+ivSize]
+	ciphertext := message[1+tagSize+ivSize:]
+	gcm, err := newGCM(key)
+	if err != nil {
+		return msg, err
+	}
+	plaintext, err := gcm.Open(nil, iv, append(ciphertext[:len(ciphertext):len(ciphertext)], tag...), nil)
+	if err != nil || !json.Valid(plaintext) {
+		return msg, decryptionError
+	}
+	msg.Push = plaintext
+	return msg, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
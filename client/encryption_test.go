@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newEncryptedClient(t *testing.T, password string) (*Client, *FakeRoundTripper) {
+	fakeRT := &FakeRoundTripper{message: `{"iden": "ujpah72o0"}`, status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	if err := client.SetEncryptionPassword(context.Background(), password); err != nil {
+		t.Fatal(err)
+	}
+	fakeRT.Reset()
+	return client, fakeRT
+}
+
+// Returns the ephemeral sent by the request.
+func sentEphemeral(t *testing.T, req *http.Request) map[string]any {
+	var params struct {
+		Push map[string]any `json:"push"`
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(body, &params); err != nil {
+		t.Fatal(err)
+	}
+	return params.Push
+}
+
+func TestPushEphemeralEncrypted(t *testing.T) {
+	client, fakeRT := newEncryptedClient(t, "hunter2")
+	ctx := context.Background()
+	if err := client.PushEphemeral(ctx, Params{"type": "clip", "body": "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	push := sentEphemeral(t, fakeRT.requests[0])
+	ciphertext, _ := push["ciphertext"].(string)
+	if push["encrypted"] != true || len(push) != 2 || strings.Contains(ciphertext, "secret") {
+		t.Fatalf("Expected an encrypted ephemeral, got %#v", push)
+	}
+	message, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || message[0] != '1' {
+		t.Errorf("Expected a version 1 message, got %q", message)
+	}
+
+	msg, err := client.decrypt(StreamMessage{Type: "push", Push: json.RawMessage(`{"encrypted": true, "ciphertext": "` + ciphertext + `"}`)})
+	if err != nil || !strings.Contains(string(msg.Push), `"body":"secret"`) {
+		t.Errorf("Expected the ephemeral decrypted, got %s, %v", msg.Push, err)
+	}
+	other, _ := newEncryptedClient(t, "hunter3")
+	if _, err := other.decrypt(StreamMessage{Type: "push", Push: json.RawMessage(`{"encrypted": true, "ciphertext": "` + ciphertext + `"}`)}); err != decryptionError {
+		t.Errorf("Expected decryptionError with another password, got %v", err)
+	}
+
+	if err := client.PushEphemeral(ctx, Params{"type": "clip", "body": "public"}, WithEncryption(false)); err != nil {
+		t.Fatal(err)
+	}
+	if push := sentEphemeral(t, fakeRT.requests[1]); push["body"] != "public" {
+		t.Errorf("Expected the ephemeral in clear, got %#v", push)
+	}
+}
+
+func TestPushEphemeralNoPassword(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "{}", status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	if err := client.PushEphemeral(context.Background(), Params{"type": "clip"}, WithEncryption(true)); err != noEncryptionKeyError {
+		t.Errorf("Expected noEncryptionKeyError, got %v", err)
+	}
+	if len(fakeRT.requests) != 0 {
+		t.Errorf("Expected nothing sent, got %d requests", len(fakeRT.requests))
+	}
+
+	client, fakeRT = newEncryptedClient(t, "hunter2")
+	client.SetEncryptionPassword(context.Background(), "")
+	client.PushEphemeral(context.Background(), Params{"type": "clip", "body": "foo"})
+	if push := sentEphemeral(t, fakeRT.requests[0]); push["body"] != "foo" {
+		t.Errorf("Expected the ephemeral in clear once the password is cleared, got %#v", push)
+	}
+}
+
+func TestStreamDecrypts(t *testing.T) {
+	client, _ := newEncryptedClient(t, "hunter2")
+	client.device = "dev1"
+	own, _ := encrypt(client.key(), Params{"type": "mirror", "source_device_iden": "dev1"})
+	mirror, _ := encrypt(client.key(), Params{"type": "mirror", "title": "foo"})
+	messages := make(chan string, 3)
+	for _, push := range []Params{own, mirror, {"encrypted": true, "ciphertext": "bm9wZQ=="}} {
+		data, _ := json.Marshal(Params{"type": "push", "push": push})
+		messages <- string(data)
+	}
+	server := newStreamServer(t, messages)
+	client.StreamURL = "ws" + strings.TrimPrefix(server.URL, "http") + "/websocket/"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var received []StreamMessage
+	client.Stream(ctx, func(msg StreamMessage) {
+		received = append(received, msg)
+		if len(received) == 2 {
+			cancel()
+		}
+	})
+	if len(received) != 2 {
+		t.Fatalf("Expected 2 messages, got %#v", received)
+	}
+	if !strings.Contains(string(received[0].Push), `"title":"foo"`) {
+		t.Errorf("Expected the ephemeral decrypted, got %s", received[0].Push)
+	}
+	if !strings.Contains(string(received[1].Push), `"ciphertext"`) {
+		t.Errorf("Expected the undecryptable ephemeral as received, got %s", received[1].Push)
+	}
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// How far back the client looks for a push it may already have created.
+var guidLookback = time.Minute
+
+// NewGUID returns a random identifier suitable for the guid of a push.
+func NewGUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Creates a push, retrying with the same guid. Before a retry the push is
+// looked up by guid in case the failed attempt reached the server, and so it
+// is before the first attempt with WithGUIDLookback.
+func (c *Client) createPush(ctx context.Context, params Params) (Push, error) {
+	guid := fmt.Sprint(params["guid"])
+	since := time.Now().Add(-guidLookback)
+	if lookback := requestConfigFrom(ctx).lookback; lookback > 0 {
+		if push, ok := c.findPush(ctx, guid, time.Now().Add(-lookback)); ok {
+			c.logger().Debug("pushbullet push already created", "guid", guid, "iden", push.Iden)
+			return push, nil
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		var push Push
+		err := c.Do(ctx, "POST", apiEndpoints["pushes"], params, &push, WithoutRetry())
+		if err == nil {
+			return push, nil
+		}
+		wait, ok := c.retryWait(ctx, true, attempt, err)
+		if !ok {
+			return Push{}, err
+		}
+		c.logger().Debug("pushbullet create push retry", "guid", guid, "attempt", attempt+1, "wait", wait, "error", err)
+		if err := sleep(ctx, wait); err != nil {
+			return Push{}, err
+		}
+		if push, ok := c.findPush(ctx, guid, since); ok {
+			c.logger().Debug("pushbullet push already created", "guid", guid, "iden", push.Iden)
+			return push, nil
+		}
+	}
+}
+
+// Looks for the push with guid among the pushes modified after since.
+func (c *Client) findPush(ctx context.Context, guid string, since time.Time) (Push, bool) {
+	modifiedAfter := Timestamp(since)
+	pushes, err := c.GetPushes(ctx, Params{"modified_after": modifiedAfter}, WithoutRetry())
+	if err != nil {
+		return Push{}, false
+	}
+	for _, push := range pushes {
+		if push.Guid == guid {
+			return push, true
+		}
+	}
+	return Push{}, false
+}
@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Serves requests with an http.Handler without opening a socket.
+type handlerRoundTripper struct {
+	handler  http.Handler
+	requests []*http.Request
+}
+
+func (rt *handlerRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.requests = append(rt.requests, r)
+	rec := httptest.NewRecorder()
+	rt.handler.ServeHTTP(rec, r)
+	return rec.Result(), nil
+}
+
+// Returns the params sent by the requests of rt.
+func sentParams(rt *FakeRoundTripper) []Params {
+	var sent []Params
+	for _, r := range rt.requests {
+		var params Params
+		json.NewDecoder(r.Body).Decode(&params)
+		sent = append(sent, params)
+	}
+	return sent
+}
+
+func TestCreatePushGUID(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "{}", status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	params := Params{"type": "note"}
+	client.CreatePush(context.Background(), params)
+	client.CreatePush(context.Background(), params)
+	sent := sentParams(fakeRT)
+	guid, ok := sent[0]["guid"].(string)
+	if !ok || len(guid) != 32 {
+		t.Errorf("Expected generated guid, got %#v", sent[0]["guid"])
+	}
+	// Reused params get a new guid.
+	if sent[1]["guid"] == guid || len(params) != 1 {
+		t.Errorf("Expected unique guids and params untouched, got %#v, %#v", sent, params)
+	}
+}
+
+func TestCreatePushRetryFindsCreatedPush(t *testing.T) {
+	fastRetries(t)
+	var posts int
+	var query string
+	rt := &handlerRoundTripper{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			posts++
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		query = r.URL.RawQuery
+		fmt.Fprint(w, `{"pushes": [{"iden": "other", "guid": "foo"}, {"iden": "ubdpj29aOK0sKG", "guid": "0xguid"}]}`)
+	})}
+	client := newTestClient(rt)
+	client.MaxRetries = 2
+	push, err := client.CreatePush(context.Background(), Params{"type": "note", "guid": "0xguid"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %#v", err)
+	}
+	if push.Iden != "ubdpj29aOK0sKG" {
+		t.Errorf("Expected push found by guid, got %#v", push)
+	}
+	if posts != 1 {
+		t.Errorf("Expected 1 POST, got %d", posts)
+	}
+	if !strings.HasPrefix(query, "modified_after=") {
+		t.Errorf("Expected modified_after query, got %q", query)
+	}
+}
+
+func TestCreatePushRetryResendsGUID(t *testing.T) {
+	fastRetries(t)
+	var guids []string
+	rt := &handlerRoundTripper{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			fmt.Fprint(w, `{"pushes": []}`)
+			return
+		}
+		var params Params
+		json.NewDecoder(r.Body).Decode(&params)
+		guids = append(guids, params["guid"].(string))
+		if len(guids) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"iden": "ubdpj29aOK0sKG"}`)
+	})}
+	client := newTestClient(rt)
+	client.MaxRetries = 2
+	push, err := client.CreatePush(context.Background(), Params{"type": "note"})
+	if err != nil || push.Iden != "ubdpj29aOK0sKG" {
+		t.Fatalf("Expected push, got %#v, %#v", push, err)
+	}
+	if len(guids) != 2 || guids[0] != guids[1] {
+		t.Errorf("Expected the same guid on both attempts, got %#v", guids)
+	}
+}
+
+func TestCreatePushGUIDLookback(t *testing.T) {
+	var posts int
+	rt := &handlerRoundTripper{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			posts++
+			fmt.Fprint(w, `{"iden": "new"}`)
+			return
+		}
+		fmt.Fprint(w, `{"pushes": [{"iden": "ubdpj29aOK0sKG", "guid": "0xguid"}]}`)
+	})}
+	client := newTestClient(rt)
+	push, err := client.CreatePush(context.Background(), Params{"type": "note", "guid": "0xguid"}, WithGUIDLookback(time.Hour))
+	if err != nil || push.Iden != "ubdpj29aOK0sKG" || posts != 0 {
+		t.Errorf("Expected the push found by guid, got %#v, %v, %d POSTs", push, err, posts)
+	}
+	push, err = client.CreatePush(context.Background(), Params{"type": "note", "guid": "0xother"}, WithGUIDLookback(time.Hour))
+	if err != nil || push.Iden != "new" || posts != 1 {
+		t.Errorf("Expected the push created, got %#v, %v, %d POSTs", push, err, posts)
+	}
+}
+
+func TestGetPushesCursor(t *testing.T) {
+	rt := &handlerRoundTripper{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("cursor") == "" {
+			fmt.Fprint(w, `{"pushes": [{"iden": "a"}, {"iden": "b"}], "cursor": "next"}`)
+			return
+		}
+		fmt.Fprint(w, `{"pushes": [{"iden": "c"}]}`)
+	})}
+	client := newTestClient(rt)
+	pushes, err := client.GetPushes(context.Background(), Params{"modified_after": 1411595135.9685705})
+	if err != nil || len(pushes) != 3 {
+		t.Fatalf("Expected 3 pushes, got %#v, %#v", pushes, err)
+	}
+	if got := rt.requests[0].URL.Query().Get("modified_after"); got != "1411595135.9685705" {
+		t.Errorf("Expected modified_after=1411595135.9685705, got %q", got)
+	}
+	if got := rt.requests[1].URL.Query().Get("modified_after"); got != "1411595135.9685705" {
+		t.Errorf("Expected modified_after on every page, got %q", got)
+	}
+
+	rt.requests = nil
+	pushes, _ = client.GetPushes(context.Background(), Params{"limit": 1})
+	if len(pushes) != 1 || len(rt.requests) != 1 {
+		t.Errorf("Expected 1 push from 1 request, got %d from %d", len(pushes), len(rt.requests))
+	}
+}
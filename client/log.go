@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// Attribute keys whose values are never written to the log.
+var sensitiveKeys = map[string]bool{
+	"authorization": true,
+	"access-token":  true,
+	"access_token":  true,
+	"token":         true,
+}
+
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// Returns the logger used by the client. When no Logger has been set the
+// client is silent, otherwise every record goes through a handler that
+// redacts the access token.
+func (c *Client) logger() *slog.Logger {
+	if c.Logger == nil {
+		return discardLogger
+	}
+	return slog.New(&redactHandler{handler: c.Logger.Handler(), token: c.token})
+}
+
+// redactHandler wraps a slog.Handler and strips the access token and
+// Authorization headers from records before they reach it.
+type redactHandler struct {
+	handler slog.Handler
+	token   string
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	record := slog.NewRecord(r.Time, r.Level, h.redactString(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		record.AddAttrs(h.redactAttr(a))
+		return true
+	})
+	return h.handler.Handle(ctx, record)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clean := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		clean[i] = h.redactAttr(a)
+	}
+	return &redactHandler{handler: h.handler.WithAttrs(clean), token: h.token}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{handler: h.handler.WithGroup(name), token: h.token}
+}
+
+func (h *redactHandler) redactAttr(a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, h.redactString(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		clean := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			clean[i] = h.redactAttr(ga)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(clean...)}
+	case slog.KindAny:
+		switch val := v.Any().(type) {
+		case http.Header:
+			return slog.Any(a.Key, redactHeader(val))
+		case error:
+			return slog.String(a.Key, h.redactString(val.Error()))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+func (h *redactHandler) redactString(s string) string {
+	if h.token == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, h.token, redacted)
+}
+
+func redactHeader(header http.Header) http.Header {
+	clean := header.Clone()
+	for k := range clean {
+		if sensitiveKeys[strings.ToLower(k)] {
+			clean[k] = []string{redacted}
+		}
+	}
+	return clean
+}
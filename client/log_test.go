@@ -0,0 +1,61 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func newTestLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func TestLoggerSilentByDefault(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "{}", status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	if client.logger() != discardLogger {
+		t.Errorf("Expected discard logger when no Logger is set")
+	}
+	if _, err := client.GetMe(context.Background()); err != nil {
+		t.Errorf("Expected no error, got %#v", err)
+	}
+}
+
+func TestLoggerRequest(t *testing.T) {
+	var buf bytes.Buffer
+	fakeRT := &FakeRoundTripper{message: "{}", status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	client.Logger = newTestLogger(&buf)
+	client.GetMe(context.Background())
+	out := buf.String()
+	for _, want := range []string{"level=DEBUG", "method=GET", "endpoint=" + client.url(apiEndpoints["me"]), "status=200", "latency="} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected log to contain %q, got %q", want, out)
+		}
+	}
+}
+
+func TestLoggerRedactsToken(t *testing.T) {
+	var buf bytes.Buffer
+	client := newTestClient(&FakeRoundTripper{})
+	client.Logger = newTestLogger(&buf)
+	header := http.Header{}
+	header.Set("Authorization", "Bearer foobar")
+	header.Set("Accept", "application/json")
+	client.logger().With("token", "foobar").Debug("token foobar",
+		"url", "https://example.com/?key=foobar",
+		"header", header,
+		"error", errors.New("bad token foobar"),
+		slog.Group("auth", "access_token", "foobar"))
+	out := buf.String()
+	if strings.Contains(out, "foobar") {
+		t.Errorf("Expected token to be redacted, got %q", out)
+	}
+	if !strings.Contains(out, "application/json") {
+		t.Errorf("Expected non sensitive headers to be kept, got %q", out)
+	}
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"strconv"
+)
+
+var noTargetError = errors.New("No target")
+
+// Target is a recipient of CreatePushMulti. Exactly one field must be set.
+type Target struct {
+	DeviceIden string
+	// DeviceNickname is resolved to a device by the Resolver of the client,
+	// so it may also be a model or type, or be slightly misspelled.
+	DeviceNickname string
+	Email          string
+	// Chat is resolved to the email of a chat by the Resolver of the client.
+	Chat       string
+	ChannelTag string
+}
+
+func (t Target) String() string {
+	switch {
+	case t.DeviceIden != "":
+		return "device " + t.DeviceIden
+	case t.DeviceNickname != "":
+		return "device " + strconv.Quote(t.DeviceNickname)
+	case t.Email != "":
+		return "email " + t.Email
+	case t.Chat != "":
+		return "chat " + strconv.Quote(t.Chat)
+	case t.ChannelTag != "":
+		return "channel " + t.ChannelTag
+	}
+	return "no target"
+}
+
+// PushResult is the outcome of a push to one target.
+type PushResult struct {
+	Target Target
+	Push   Push
+	Err    error
+}
+
+// Create the same push for several targets.
+// See: https://docs.pushbullet.com/v2/pushes/
+//
+// Usage:
+//
+//	results, err := client.CreatePushMulti(ctx, client.Params{"type": "note", "title": "disk full"}, []client.Target{
+//		{DeviceNickname: "Pixel"},
+//		{Email: "oncall@example.com"},
+//		{ChannelTag: "alerts"},
+//	})
+//
+// The pushes are created concurrently. A file is uploaded once and its
+// file_url shared by every push. Each push gets its own guid, derived from
+// the guid of push if it has one. The results are in the order of targets;
+// a failed target does not stop the others and err joins their errors.
+func (c *Client) CreatePushMulti(ctx context.Context, push Params, targets []Target, opts ...RequestOption) ([]PushResult, error) {
+	ctx, cancel := withRequestOptions(ctx, opts)
+	defer cancel()
+	cfg := requestConfigFrom(ctx)
+	base, _ := push["guid"].(string)
+	if cfg.guid != "" {
+		base = cfg.guid
+	}
+	// The guid of the call is the base of the guids of the pushes.
+	cfg.guid = ""
+	ctx = context.WithValue(ctx, requestConfigKey{}, cfg)
+
+	if _, ok := push["file_url"]; push["type"] == "file" && !ok {
+		filename, hasName := push["file_name"].(string)
+		filetype, hasType := push["file_type"].(string)
+		if hasName && hasType {
+			fileUrl, err := c.PushFile(ctx, filename, filetype, filename)
+			if err != nil {
+				return nil, err
+			}
+			push = copyParams(push)
+			push["file_url"] = fileUrl
+		}
+	}
+
+	results := make([]PushResult, len(targets))
+	ops := make([]Op, len(targets))
+	for i, target := range targets {
+		i, target := i, target
+		results[i].Target = target
+		ops[i] = Op{Key: target.String(), Run: func(ctx context.Context, c *Client) error {
+			params := copyParams(push)
+			for _, key := range []string{"device_iden", "email", "channel_tag", "client_iden"} {
+				delete(params, key)
+			}
+			switch {
+			case target.DeviceIden != "":
+				params["device_iden"] = target.DeviceIden
+			case target.DeviceNickname != "":
+				device, err := c.Resolver().Device(ctx, target.DeviceNickname)
+				if err != nil {
+					return err
+				}
+				params["device_iden"] = device.Iden
+			case target.Email != "":
+				params["email"] = target.Email
+			case target.Chat != "":
+				chat, err := c.Resolver().Chat(ctx, target.Chat)
+				if err != nil {
+					return err
+				}
+				params["email"] = chat.With.Email
+			case target.ChannelTag != "":
+				params["channel_tag"] = target.ChannelTag
+			default:
+				return noTargetError
+			}
+			if base != "" {
+				params["guid"] = base + "-" + strconv.Itoa(i)
+			} else {
+				delete(params, "guid")
+			}
+			var err error
+			results[i].Push, err = c.CreatePush(ctx, params)
+			return err
+		}}
+	}
+	report, err := c.Batch(ctx, ops, BatchOptions{Workers: len(ops)})
+	for i, result := range report.Results {
+		results[i].Err = result.Err
+	}
+	return results, err
+}
+
+func copyParams(params Params) Params {
+	c := make(Params, len(params))
+	for k, v := range params {
+		c[k] = v
+	}
+	return c
+}
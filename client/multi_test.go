@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCreatePushMulti(t *testing.T) {
+	var mu sync.Mutex
+	uploads := 0
+	var pushes []Params
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/devices"):
+			w.Write([]byte(`{"devices": [
+				{"iden": "pixel", "nickname": "Pixel", "active": true},
+				{"iden": "old", "nickname": "Laptop", "active": false},
+				{"iden": "laptop1", "nickname": "Laptop", "active": true},
+				{"iden": "laptop2", "nickname": "laptop", "active": true}
+			]}`))
+		case strings.HasSuffix(r.URL.Path, "/upload-request"):
+			w.Write([]byte(`{"file_url": "https://files.example.com/report.txt", "upload_url": "https://upload.example.com/"}`))
+		case r.URL.Host == "upload.example.com":
+			uploads++
+			w.WriteHeader(http.StatusNoContent)
+		case strings.HasSuffix(r.URL.Path, "/pushes"):
+			var params Params
+			json.NewDecoder(r.Body).Decode(&params)
+			pushes = append(pushes, params)
+			if params["email"] == "bounce@example.com" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error": {"type": "invalid_request", "message": "Invalid email"}}`))
+				return
+			}
+			json.NewEncoder(w).Encode(Push{Iden: "push-" + params["guid"].(string), Guid: params["guid"].(string)})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	client := newTestClient(roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return (&handlerRoundTripper{handler: handler}).RoundTrip(r)
+	}))
+
+	path := filepath.Join(t.TempDir(), "report.txt")
+	os.WriteFile(path, []byte("disk full"), 0600)
+	targets := []Target{
+		{DeviceNickname: "pixel"},
+		{DeviceIden: "tablet"},
+		{Email: "bounce@example.com"},
+		{ChannelTag: "alerts"},
+		{DeviceNickname: "Laptop"},
+		{DeviceNickname: "Phone"},
+		{},
+	}
+	push := Params{"type": "file", "file_name": path, "file_type": "text/plain", "guid": "alert"}
+	results, err := client.CreatePushMulti(context.Background(), push, targets)
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if uploads != 1 {
+		t.Errorf("Expected 1 upload, got %d", uploads)
+	}
+	if len(pushes) != 4 {
+		t.Errorf("Expected 4 pushes, got %d", len(pushes))
+	}
+	for _, p := range pushes {
+		if p["file_url"] != "https://files.example.com/report.txt" {
+			t.Errorf("Expected shared file_url, got %#v", p)
+		}
+	}
+	if len(results) != len(targets) {
+		t.Fatalf("Expected %d results, got %d", len(targets), len(results))
+	}
+	for i, result := range results {
+		if result.Target != targets[i] {
+			t.Errorf("Expected result %d for %v, got %v", i, targets[i], result.Target)
+		}
+		failed := i >= 2 && i != 3
+		if (result.Err != nil) != failed {
+			t.Errorf("Unexpected error for %v: %v", result.Target, result.Err)
+		}
+	}
+	if results[0].Push.Guid != "alert-0" || results[1].Push.Guid != "alert-1" {
+		t.Errorf("Expected derived guids, got %q and %q", results[0].Push.Guid, results[1].Push.Guid)
+	}
+	var resolveErr *ResolveError
+	if !errors.As(results[4].Err, &resolveErr) || !resolveErr.Ambiguous() {
+		t.Errorf("Expected ambiguous nickname, got %v", results[4].Err)
+	}
+	if results[6].Err != noTargetError {
+		t.Errorf("Expected noTargetError, got %v", results[6].Err)
+	}
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Call describes a finished API call. It is handed to the Observer of the
+// client once the call returns.
+type Call struct {
+	// Logical operation, e.g. "CreatePush" or "GetDevices".
+	Operation string
+	Method    string
+	Endpoint  string
+	// Zero based attempt number, greater than zero for retries.
+	Attempt int
+	// HTTP status of the response, 0 if none was received.
+	Status   int
+	Duration time.Duration
+	Err      error
+	// Value of the X-Ratelimit-Remaining header, -1 if unknown.
+	RateLimitRemaining int
+	// Size of the multipart body sent by PushFile.
+	BytesUploaded int64
+	// Bytes received by DownloadFile.
+	BytesDownloaded int64
+}
+
+// Observer is notified around every API call made by the client, which makes
+// it the hook for metrics and tracing. See the pbprom and pbotel packages.
+//
+// Start is called before the call is made. The returned context is used for
+// the call, so an Observer may attach a span to it. The returned function is
+// called exactly once with the outcome of the call.
+type Observer interface {
+	Start(ctx context.Context, operation string) (context.Context, func(Call))
+}
+
+// Observers combines several observers into one.
+//
+// Usage:
+//
+//	client.Observer = client.Observers(metrics, tracer)
+func Observers(observers ...Observer) Observer {
+	return multiObserver(observers)
+}
+
+type multiObserver []Observer
+
+func (m multiObserver) Start(ctx context.Context, operation string) (context.Context, func(Call)) {
+	dones := make([]func(Call), len(m))
+	for i, o := range m {
+		ctx, dones[i] = o.Start(ctx, operation)
+	}
+	return ctx, func(call Call) {
+		for i := len(dones) - 1; i >= 0; i-- {
+			dones[i](call)
+		}
+	}
+}
+
+func (c *Client) observe(ctx context.Context, operation string) (context.Context, func(Call)) {
+	if c.Observer == nil {
+		return ctx, func(Call) {}
+	}
+	return c.Observer.Start(ctx, operation)
+}
+
+func rateLimitRemaining(header http.Header) int {
+	remaining, err := strconv.Atoi(header.Get("X-Ratelimit-Remaining"))
+	if err != nil {
+		return -1
+	}
+	return remaining
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+type recordingObserver struct {
+	started []string
+	calls   []Call
+}
+
+func (o *recordingObserver) Start(ctx context.Context, operation string) (context.Context, func(Call)) {
+	o.started = append(o.started, operation)
+	return ctx, func(call Call) {
+		o.calls = append(o.calls, call)
+	}
+}
+
+func TestObserver(t *testing.T) {
+	fakeRT := &FakeRoundTripper{
+		message: `{"devices": []}`,
+		status:  http.StatusOK,
+		header:  map[string]string{"X-Ratelimit-Remaining": "4200"},
+	}
+	observer := &recordingObserver{}
+	client := newTestClient(fakeRT)
+	client.Observer = observer
+	if _, err := client.GetDevices(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %#v", err)
+	}
+	if len(observer.calls) != 1 {
+		t.Fatalf("Expected 1 call, got %d", len(observer.calls))
+	}
+	call := observer.calls[0]
+	if call.Operation != "GetDevices" || call.Method != "GET" || call.Endpoint != client.url(apiEndpoints["devices"]) {
+		t.Errorf("Unexpected call %#v", call)
+	}
+	if call.Status != http.StatusOK || call.RateLimitRemaining != 4200 || call.Err != nil {
+		t.Errorf("Unexpected call %#v", call)
+	}
+}
+
+func TestObserverError(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "", status: http.StatusUnauthorized}
+	observer := &recordingObserver{}
+	client := newTestClient(fakeRT)
+	client.Observer = Observers(observer, observer)
+	client.DeletePush(context.Background(), Params{"iden": "0xyz"})
+	if len(observer.started) != 2 || len(observer.calls) != 2 {
+		t.Fatalf("Expected 2 started and 2 finished calls, got %#v", observer)
+	}
+	call := observer.calls[0]
+	if call.Operation != "DeletePush" || call.Status != http.StatusUnauthorized || call.Err == nil {
+		t.Errorf("Unexpected call %#v", call)
+	}
+	if call.RateLimitRemaining != -1 {
+		t.Errorf("Expected unknown rate limit, got %d", call.RateLimitRemaining)
+	}
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// RequestOption customizes a single call. Every method of Client accepts
+// options after its regular arguments.
+//
+// Usage:
+//
+//	user, err := client.GetMe(ctx, client.WithTimeout(2*time.Second), client.WithoutRetry())
+type RequestOption func(*requestConfig)
+
+type requestConfig struct {
+	timeout time.Duration
+	header  http.Header
+	guid    string
+	noRetry bool
+	// Set by WithGUIDLookback.
+	lookback time.Duration
+	sha256   string
+	// Set by WithEncryption, nil to encrypt when a password is set.
+	encryption *bool
+}
+
+type requestConfigKey struct{}
+
+// WithTimeout bounds the call, including retries and file uploads, by d.
+func WithTimeout(d time.Duration) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.timeout = d
+	}
+}
+
+// WithHeader adds a header to the API requests of the call.
+func WithHeader(key, value string) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.header.Add(key, value)
+	}
+}
+
+// WithIdempotencyGUID sets the guid of the push created by the call.
+// See: https://docs.pushbullet.com/#create-push
+func WithIdempotencyGUID(guid string) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.guid = guid
+	}
+}
+
+// WithGUIDLookback makes CreatePush return the push created with the same
+// guid within d, if any, instead of creating it again, for callers retrying
+// a push across requests or restarts. With CreatePushMulti, only the pushes
+// missing for some targets are created.
+func WithGUIDLookback(d time.Duration) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.lookback = d
+	}
+}
+
+// WithoutRetry disables retries for the call.
+func WithoutRetry() RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.noRetry = true
+	}
+}
+
+// WithSHA256 makes DownloadFile verify the downloaded file against the hex
+// encoded SHA-256 sum.
+func WithSHA256(sum string) RequestOption {
+	return func(cfg *requestConfig) {
+		cfg.sha256 = sum
+	}
+}
+
+// Returns the options in effect for ctx.
+func requestConfigFrom(ctx context.Context) requestConfig {
+	if cfg, ok := ctx.Value(requestConfigKey{}).(requestConfig); ok {
+		return cfg
+	}
+	return requestConfig{}
+}
+
+// Applies opts on top of the options already carried by ctx. The returned
+// cancel function must be called once the call is done.
+func withRequestOptions(ctx context.Context, opts []RequestOption) (context.Context, context.CancelFunc) {
+	if len(opts) == 0 {
+		return ctx, func() {}
+	}
+	cfg := requestConfigFrom(ctx)
+	cfg.header = cfg.header.Clone()
+	if cfg.header == nil {
+		cfg.header = http.Header{}
+	}
+	cfg.timeout = 0
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	ctx = context.WithValue(ctx, requestConfigKey{}, cfg)
+	if cfg.timeout > 0 {
+		return context.WithTimeout(ctx, cfg.timeout)
+	}
+	return ctx, func() {}
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWithHeader(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "{}", status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	client.GetMe(context.Background(), WithHeader("X-Request-Id", "42"))
+	if got := fakeRT.requests[0].Header.Get("X-Request-Id"); got != "42" {
+		t.Errorf("Expected header 42, got %#v", got)
+	}
+	client.GetMe(context.Background())
+	if got := fakeRT.requests[1].Header.Get("X-Request-Id"); got != "" {
+		t.Errorf("Expected no header, got %#v", got)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "{}", status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	client.GetMe(context.Background(), WithTimeout(time.Minute))
+	deadline, ok := fakeRT.requests[0].Context().Deadline()
+	if !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("Expected a deadline within a minute, got %v", deadline)
+	}
+	client.GetMe(context.Background())
+	if _, ok := fakeRT.requests[1].Context().Deadline(); ok {
+		t.Errorf("Expected no deadline")
+	}
+}
+
+func TestWithoutRetry(t *testing.T) {
+	fastRetries(t)
+	fakeRT := &sequenceRoundTripper{statuses: []int{500, 200}}
+	client := newTestClient(fakeRT)
+	client.MaxRetries = 3
+	if _, err := client.GetDevices(context.Background(), WithoutRetry()); err == nil {
+		t.Errorf("Expected error")
+	}
+	if len(fakeRT.requests) != 1 {
+		t.Errorf("Expected 1 request, got %d", len(fakeRT.requests))
+	}
+}
+
+func TestWithIdempotencyGUID(t *testing.T) {
+	fakeRT := &FakeRoundTripper{message: "{}", status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	client.CreatePush(context.Background(), Params{"type": "note"}, WithIdempotencyGUID("0xguid"))
+	body, _ := ioutil.ReadAll(fakeRT.requests[0].Body)
+	var params Params
+	json.Unmarshal(body, &params)
+	if params["guid"] != "0xguid" {
+		t.Errorf("Expected guid 0xguid, got %#v", params)
+	}
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimit is the state of the rate limit as last reported by the API.
+// See: https://docs.pushbullet.com/#ratelimiting
+type RateLimit struct {
+	// Limit and Remaining are -1 until a response reported them.
+	Limit     int
+	Remaining int
+	// Reset is when the remaining quota is refilled.
+	Reset time.Time
+}
+
+// Get the rate limit reported by the last response.
+//
+// Usage:
+//
+//	if client.RateLimit().Remaining < 100 {
+//	  ...
+//	}
+func (c *Client) RateLimit() RateLimit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rateLimit == (RateLimit{}) {
+		return RateLimit{Limit: -1, Remaining: -1}
+	}
+	return c.rateLimit
+}
+
+func (c *Client) updateRateLimit(header http.Header) {
+	remaining := rateLimitRemaining(header)
+	if remaining < 0 {
+		return
+	}
+	rateLimit := RateLimit{Limit: -1, Remaining: remaining}
+	if limit, err := strconv.Atoi(header.Get("X-Ratelimit-Limit")); err == nil {
+		rateLimit.Limit = limit
+	}
+	if reset, err := strconv.ParseInt(header.Get("X-Ratelimit-Reset"), 10, 64); err == nil {
+		rateLimit.Reset = time.Unix(reset, 0)
+	}
+	c.mu.Lock()
+	c.rateLimit = rateLimit
+	c.mu.Unlock()
+}
+
+// Wait until the rate limit resets if fewer than min requests are left.
+//
+// Usage:
+//
+//	if err := client.WaitRateLimit(ctx, 50); err != nil {
+//	  return err
+//	}
+func (c *Client) WaitRateLimit(ctx context.Context, min int) error {
+	rateLimit := c.RateLimit()
+	if rateLimit.Remaining < 0 || rateLimit.Remaining >= min {
+		return nil
+	}
+	if wait := time.Until(rateLimit.Reset); wait > 0 {
+		return sleep(ctx, wait)
+	}
+	return nil
+}
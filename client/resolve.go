@@ -0,0 +1,274 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// DefaultResolverTTL is how long a Resolver reuses the devices and chats it
+// fetched.
+const DefaultResolverTTL = 30 * time.Second
+
+// ResolveError is returned when a name matches no item or several items.
+type ResolveError struct {
+	// device or chat.
+	Kind string
+	Name string
+	// Matches lists the candidates of an ambiguous name.
+	Matches []string
+}
+
+func (e *ResolveError) Error() string {
+	if len(e.Matches) == 0 {
+		return fmt.Sprintf("No %s matches %q", e.Kind, e.Name)
+	}
+	return fmt.Sprintf("%q matches several %ss: %s", e.Name, e.Kind, strings.Join(e.Matches, ", "))
+}
+
+// Ambiguous reports whether the name matched several items.
+func (e *ResolveError) Ambiguous() bool {
+	return len(e.Matches) > 1
+}
+
+// Resolver finds devices and chats by human-friendly names instead of idens.
+//
+// Names are matched, in order of preference, against the iden, then exactly
+// (ignoring case) against the device nickname, model and type or the chat
+// email and name, then as a prefix of them or of one of their words, and
+// finally with up to two typos. The best kind of match wins; several items
+// matching equally well is an ambiguity error.
+//
+// Usage:
+//
+//	device, err := client.Resolver().Device(ctx, "pixel")
+//	chat, err := client.Resolver().Chat(ctx, "alice")
+type Resolver struct {
+	// TTL is how long fetched devices and chats are reused.
+	TTL time.Duration
+
+	client    *Client
+	mu        sync.Mutex
+	devices   []Device
+	devicesAt time.Time
+	chats     []Chat
+	chatsAt   time.Time
+}
+
+// NewResolver returns a Resolver for the account of c.
+func NewResolver(c *Client) *Resolver {
+	return &Resolver{TTL: DefaultResolverTTL, client: c}
+}
+
+// Resolver returns the Resolver shared by the calls of the client, used to
+// resolve push targets given by name.
+func (c *Client) Resolver() *Resolver {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resolver == nil {
+		c.resolver = NewResolver(c)
+	}
+	return c.resolver
+}
+
+// Device returns the active device named name.
+func (r *Resolver) Device(ctx context.Context, name string) (Device, error) {
+	devices, err := r.Devices(ctx)
+	if err != nil {
+		return Device{}, err
+	}
+	var active []Device
+	for _, device := range devices {
+		if device.Active {
+			active = append(active, device)
+		}
+	}
+	i, err := match("device", name, len(active), func(i int) (string, []string) {
+		d := active[i]
+		return d.Iden, []string{d.Nickname, d.Model, d.Type}
+	})
+	if err != nil {
+		return Device{}, err
+	}
+	return active[i], nil
+}
+
+// Chat returns the active chat with the person or group named name.
+func (r *Resolver) Chat(ctx context.Context, name string) (Chat, error) {
+	chats, err := r.Chats(ctx)
+	if err != nil {
+		return Chat{}, err
+	}
+	var active []Chat
+	for _, chat := range chats {
+		if chat.Active {
+			active = append(active, chat)
+		}
+	}
+	i, err := match("chat", name, len(active), func(i int) (string, []string) {
+		c := active[i]
+		return c.Iden, []string{c.With.Email, c.With.EmailNormalized, c.With.Name}
+	})
+	if err != nil {
+		return Chat{}, err
+	}
+	return active[i], nil
+}
+
+// Devices returns the devices of the account, fetched at most TTL ago.
+func (r *Resolver) Devices(ctx context.Context) ([]Device, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.devicesAt.IsZero() || time.Since(r.devicesAt) > r.TTL {
+		devices, err := r.client.GetDevices(ctx)
+		if err != nil {
+			return nil, err
+		}
+		r.devices, r.devicesAt = devices, time.Now()
+	}
+	return r.devices, nil
+}
+
+// Chats returns the chats of the account, fetched at most TTL ago.
+func (r *Resolver) Chats(ctx context.Context) ([]Chat, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.chatsAt.IsZero() || time.Since(r.chatsAt) > r.TTL {
+		chats, err := r.client.GetChats(ctx)
+		if err != nil {
+			return nil, err
+		}
+		r.chats, r.chatsAt = chats, time.Now()
+	}
+	return r.chats, nil
+}
+
+// Invalidate drops the cached devices and chats.
+func (r *Resolver) Invalidate() {
+	r.invalidateDevices()
+	r.invalidateChats()
+}
+
+func (r *Resolver) invalidateDevices() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.devices, r.devicesAt = nil, time.Time{}
+}
+
+func (r *Resolver) invalidateChats() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.chats, r.chatsAt = nil, time.Time{}
+}
+
+// Kinds of matches, best first.
+const (
+	matchIden = iota
+	matchExact
+	matchPrefix
+	matchFuzzy
+	noMatch
+)
+
+// Returns the index of the only one of n items best matching name. item
+// returns the iden and the names of an item.
+func match(kind, name string, n int, item func(int) (string, []string)) (int, error) {
+	best, found := noMatch, []int(nil)
+	for i := 0; i < n; i++ {
+		iden, names := item(i)
+		m := matchName(name, iden, names)
+		switch {
+		case m < best:
+			best, found = m, []int{i}
+		case m == best && m != noMatch:
+			found = append(found, i)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return 0, &ResolveError{Kind: kind, Name: name}
+	case 1:
+		return found[0], nil
+	}
+	err := &ResolveError{Kind: kind, Name: name}
+	for _, i := range found {
+		iden, names := item(i)
+		err.Matches = append(err.Matches, fmt.Sprintf("%s (%s)", names[0], iden))
+	}
+	return 0, err
+}
+
+func matchName(name, iden string, names []string) int {
+	if name == iden {
+		return matchIden
+	}
+	best := noMatch
+	want := normalize(name)
+	if want == "" {
+		return noMatch
+	}
+	for _, n := range names {
+		got := normalize(n)
+		switch {
+		case got == "":
+		case strings.EqualFold(n, name) || got == want:
+			return matchExact
+		case strings.HasPrefix(got, want) || wordPrefix(n, want):
+			best = min(best, matchPrefix)
+		case len(want) > 3 && distance(got, want) <= 2:
+			best = min(best, matchFuzzy)
+		}
+	}
+	return best
+}
+
+// Lower-cases s and drops everything but letters and digits, so that
+// "Pixel 7" matches "pixel7".
+func normalize(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Reports whether a word of s starts with the normalized prefix, so that
+// "laptop" matches "Work Laptop".
+func wordPrefix(s, prefix string) bool {
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if strings.HasPrefix(normalize(word), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Levenshtein distance between a and b.
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestResolverDevice(t *testing.T) {
+	fakeRT := &FakeRoundTripper{
+		message: `{"devices": [
+			{"iden": "ujpah72o0", "nickname": "Pixel 7", "model": "Pixel 7", "type": "android", "active": true},
+			{"iden": "ujpah72o1", "nickname": "Work Laptop", "model": "XPS 13", "type": "windows", "active": true},
+			{"iden": "ujpah72o2", "nickname": "Home Laptop", "model": "MacBook Air", "type": "mac", "active": true},
+			{"iden": "ujpah72o3", "nickname": "Old Phone", "model": "Nexus 5", "type": "android", "active": false}
+		]}`,
+		status: http.StatusOK,
+	}
+	resolver := NewResolver(newTestClient(fakeRT))
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		iden string
+	}{
+		{"ujpah72o1", "ujpah72o1"},
+		{"pixel7", "ujpah72o0"},
+		{"work laptop", "ujpah72o1"},
+		{"mac", "ujpah72o2"},
+		{"macbook", "ujpah72o2"},
+		{"Wrok Laptop", "ujpah72o1"},
+		{"android", "ujpah72o0"},
+	}
+	for _, test := range tests {
+		device, err := resolver.Device(ctx, test.name)
+		if err != nil || device.Iden != test.iden {
+			t.Errorf("Expected %q to resolve to %s, got %s, %v", test.name, test.iden, device.Iden, err)
+		}
+	}
+
+	var resolveErr *ResolveError
+	_, err := resolver.Device(ctx, "laptop")
+	if !errors.As(err, &resolveErr) || !resolveErr.Ambiguous() || len(resolveErr.Matches) != 2 {
+		t.Errorf("Expected ambiguity error, got %v", err)
+	}
+	_, err = resolver.Device(ctx, "nexus 5")
+	if !errors.As(err, &resolveErr) || resolveErr.Ambiguous() {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+	if len(fakeRT.requests) != 1 {
+		t.Errorf("Expected devices to be fetched once, got %d", len(fakeRT.requests))
+	}
+	resolver.Invalidate()
+	resolver.Device(ctx, "pixel")
+	if len(fakeRT.requests) != 2 {
+		t.Errorf("Expected devices to be fetched again, got %d", len(fakeRT.requests))
+	}
+}
+
+func TestResolverChat(t *testing.T) {
+	fakeRT := &FakeRoundTripper{
+		message: `{"chats": [
+			{"iden": "ujlMns72k", "active": true, "with": {"type": "user", "name": "Alice Smith", "email": "alice@example.com"}},
+			{"iden": "ujlMns72l", "active": true, "with": {"type": "email", "name": "Bob", "email": "bob@example.com"}}
+		]}`,
+		status: http.StatusOK,
+	}
+	resolver := NewResolver(newTestClient(fakeRT))
+	for _, name := range []string{"alice", "Alice Smith", "ALICE@example.com"} {
+		chat, err := resolver.Chat(context.Background(), name)
+		if err != nil || chat.Iden != "ujlMns72k" {
+			t.Errorf("Expected %q to resolve to Alice, got %#v, %v", name, chat, err)
+		}
+	}
+}
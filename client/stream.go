@@ -0,0 +1,212 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	streamApi = "wss://stream.pushbullet.com/websocket/"
+	// The stream sends a nop every 30 seconds; a connection silent for
+	// longer than this is considered dead.
+	streamTimeout = 90 * time.Second
+)
+
+// StreamMessage is a message of the realtime event stream.
+// See: https://docs.pushbullet.com/#realtime-event-stream
+type StreamMessage struct {
+	// tickle or push.
+	Type string `json:"type"`
+	// Subtype of tickles: push when pushes changed, device when devices
+	// changed.
+	Subtype string `json:"subtype,omitempty"`
+	// Push of push messages, an ephemeral such as a mirrored notification
+	// or a dismissal.
+	Push json.RawMessage `json:"push,omitempty"`
+}
+
+// Listen to the realtime event stream.
+// See: https://docs.pushbullet.com/#realtime-event-stream
+//
+// Usage:
+//
+//	err := client.Stream(ctx, func(msg client.StreamMessage) {
+//		if msg.Type == "tickle" && msg.Subtype == "push" {
+//			pushes, err := client.GetPushes(ctx, client.Params{"modified_after": last})
+//			...
+//		}
+//	})
+//
+// handle is called for every message, one at a time, except nops and
+// ephemerals sent from the device set up by EnsureDevice. Encrypted
+// ephemerals are decrypted after SetEncryptionPassword, and handled as
+// received if they cannot be. Device tickles also invalidate cached
+// devices, and push tickles the chats of the Resolver. Stream reconnects
+// with backoff when the connection drops and returns once ctx is done, or
+// with an *HttpError if the stream rejects the access token.
+func (c *Client) Stream(ctx context.Context, handle func(StreamMessage)) error {
+	return c.listen(ctx, handle, nil)
+}
+
+// Call sync on every push tickle of the realtime stream and every interval,
+// starting right away, for programs keeping up with new pushes.
+//
+// Usage:
+//
+//	err := client.SyncOnTickles(ctx, 5*time.Minute, func(ctx context.Context) error {
+//		pushes, err := client.GetPushes(ctx, client.Params{"modified_after": last})
+//		...
+//	})
+//
+// Failed syncs are retried at the next occasion. SyncOnTickles returns once
+// ctx is done, or early with the error of the stream or of sync if the API
+// rejects the access token.
+func (c *Client) SyncOnTickles(ctx context.Context, interval time.Duration, sync func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// One pending tickle is enough to sync everything new.
+	tickles := make(chan struct{}, 1)
+	streamErr := make(chan error, 1)
+	go func() {
+		streamErr <- c.Stream(ctx, func(msg StreamMessage) {
+			if msg.Type == "tickle" && msg.Subtype == "push" {
+				select {
+				case tickles <- struct{}{}:
+				default:
+				}
+			}
+		})
+	}()
+	for {
+		if err := sync(ctx); IsUnauthorized(err) {
+			return err
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case err := <-streamErr:
+			// Only a rejected token stops the stream: polling would
+			// fail the same way.
+			timer.Stop()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		case <-tickles:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// Runs Stream, calling connected, if not nil, every time a connection is
+// established.
+func (c *Client) listen(ctx context.Context, handle func(StreamMessage), connected func()) error {
+	log := c.logger().With("endpoint", c.streamURL())
+	for attempt := 0; ; attempt++ {
+		received, err := c.stream(ctx, handle, connected)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var httpErr *HttpError
+		if errors.As(err, &httpErr) && httpErr.Status < 500 {
+			return err
+		}
+		if received {
+			attempt = 0
+		}
+		wait := retryBackoff << uint(min(attempt, 16))
+		if wait > maxRetryWait {
+			wait = maxRetryWait
+		}
+		log.Debug("pushbullet stream reconnect", "attempt", attempt+1, "wait", wait, "error", err)
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// Reads one connection of the stream until it fails. received reports
+// whether any message arrived.
+func (c *Client) stream(ctx context.Context, handle func(StreamMessage), connected func()) (received bool, err error) {
+	ws, err := dialWebsocket(ctx, c.streamURL())
+	if err != nil {
+		return false, err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		ws.close()
+	})
+	defer stop()
+	defer ws.close()
+	c.logger().Debug("pushbullet stream connected", "endpoint", c.streamURL())
+	if connected != nil {
+		connected()
+	}
+	for {
+		ws.conn.SetReadDeadline(time.Now().Add(streamTimeout))
+		data, err := ws.readMessage()
+		if err != nil {
+			return received, err
+		}
+		received = true
+		var msg StreamMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.logger().Debug("pushbullet stream invalid message", "error", err)
+			continue
+		}
+		if msg, err = c.decrypt(msg); err != nil {
+			c.logger().Debug("pushbullet stream encrypted message", "error", err)
+		}
+		if msg.Type == "nop" || c.own(msg) {
+			continue
+		}
+		if msg.Type == "tickle" {
+			c.tickle(msg.Subtype)
+		}
+		handle(msg)
+	}
+}
+
+// Reports whether msg is an ephemeral sent from the device of the program.
+func (c *Client) own(msg StreamMessage) bool {
+	device := c.DeviceIden()
+	if msg.Type != "push" || device == "" {
+		return false
+	}
+	var push struct {
+		SourceDeviceIden string `json:"source_device_iden"`
+	}
+	return json.Unmarshal(msg.Push, &push) == nil && push.SourceDeviceIden == device
+}
+
+// Invalidates what a tickle announces changed.
+func (c *Client) tickle(subtype string) {
+	c.mu.Lock()
+	resolver := c.resolver
+	c.mu.Unlock()
+	switch subtype {
+	case "device":
+		c.invalidate("devices")
+		if resolver != nil {
+			resolver.invalidateDevices()
+		}
+	case "push":
+		// Pushes from new contacts create chats.
+		if resolver != nil {
+			resolver.invalidateChats()
+		}
+	}
+}
+
+func (c *Client) streamURL() string {
+	base := c.StreamURL
+	if base == "" {
+		base = streamApi
+	}
+	return strings.TrimSuffix(base, "/") + "/" + c.token
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Serves the realtime stream: every connection receives the messages sent
+// on the channel.
+func newStreamServer(t *testing.T, messages <-chan string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/foobar") {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": {"type": "invalid_request", "message": "Invalid access token"}}`))
+			return
+		}
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+		brw.WriteString("Sec-WebSocket-Accept: " + acceptKey(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		brw.Flush()
+		for {
+			select {
+			case msg := <-messages:
+				frame := []byte{0x80 | wsText}
+				if len(msg) < 126 {
+					frame = append(frame, byte(len(msg)))
+				} else {
+					frame = binary.BigEndian.AppendUint16(append(frame, 126), uint16(len(msg)))
+				}
+				if _, err := conn.Write(append(frame, msg...)); err != nil {
+					return
+				}
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestStream(t *testing.T) {
+	messages := make(chan string, 4)
+	server := newStreamServer(t, messages)
+	fakeRT := &FakeRoundTripper{message: `{"devices": []}`, status: http.StatusOK}
+	client := newTestClient(fakeRT)
+	client.StreamURL = "ws" + strings.TrimPrefix(server.URL, "http") + "/websocket/"
+	client.Cache = NewCache()
+	client.GetDevices(context.Background())
+
+	client.device = "dev1"
+	messages <- `{"type": "nop"}`
+	messages <- `{"type": "push", "push": {"type": "mirror", "source_device_iden": "dev1"}}`
+	messages <- `{"type": "push", "push": {"type": "mirror", "title": "` + strings.Repeat("x", 200) + `"}}`
+	messages <- `{"type": "tickle", "subtype": "device"}`
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var received []StreamMessage
+	err := client.Stream(ctx, func(msg StreamMessage) {
+		received = append(received, msg)
+		if len(received) == 2 {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if len(received) != 2 || received[0].Type != "push" || received[1].Subtype != "device" {
+		t.Fatalf("Unexpected messages %#v", received)
+	}
+	if !strings.Contains(string(received[0].Push), `"mirror"`) {
+		t.Errorf("Expected push, got %s", received[0].Push)
+	}
+	client.GetDevices(context.Background())
+	if len(fakeRT.requests) != 2 {
+		t.Errorf("Expected the device tickle to invalidate the cache, got %d requests", len(fakeRT.requests))
+	}
+}
+
+func TestStreamUnauthorized(t *testing.T) {
+	server := newStreamServer(t, nil)
+	client := newTestClient(nil)
+	client.token = "invalid"
+	client.StreamURL = "ws" + strings.TrimPrefix(server.URL, "http") + "/websocket/"
+	err := client.Stream(context.Background(), func(StreamMessage) {})
+	httpErr, ok := err.(*HttpError)
+	if !ok || httpErr.Status != http.StatusUnauthorized {
+		t.Errorf("Expected unauthorized error, got %v", err)
+	}
+}
+
+func TestSyncOnTickles(t *testing.T) {
+	messages := make(chan string, 2)
+	server := newStreamServer(t, messages)
+	client := newTestClient(nil)
+	client.StreamURL = "ws" + strings.TrimPrefix(server.URL, "http") + "/websocket/"
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	syncs := 0
+	messages <- `{"type": "tickle", "subtype": "device"}`
+	messages <- `{"type": "tickle", "subtype": "push"}`
+	err := client.SyncOnTickles(ctx, time.Hour, func(context.Context) error {
+		syncs++
+		if syncs == 2 {
+			cancel()
+		}
+		return &HttpError{Status: http.StatusInternalServerError}
+	})
+	if err != context.Canceled || syncs != 2 {
+		t.Errorf("Expected a sync at start and on the push tickle, got %d syncs, %v", syncs, err)
+	}
+
+	err = client.SyncOnTickles(context.Background(), time.Hour, func(context.Context) error {
+		return &HttpError{Status: http.StatusUnauthorized}
+	})
+	if httpErr, ok := err.(*HttpError); !ok || httpErr.Status != http.StatusUnauthorized {
+		t.Errorf("Expected unauthorized error, got %v", err)
+	}
+}
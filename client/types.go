@@ -1,6 +1,11 @@
 package client
 
-import "net/http"
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
 
 type Subscription struct {
 	Iden    string  `json:"iden"`
@@ -29,6 +34,7 @@ type Device struct {
 	Nickname     string `json:"nickname"`
 	Manufacturer string `json:"manufacturer"`
 	Type         string `json:"type"`
+	Icon         string `json:"icon"`
 	Model        string `json:"model"`
 	Pushable     bool   `json:"pushable"`
 }
@@ -49,24 +55,67 @@ type Contacts struct {
 	Contacts []Contact `json:"contacts"`
 }
 
+type Chat struct {
+	Iden     string  `json:"iden"`
+	Active   bool    `json:"active"`
+	Created  float64 `json:"created"`
+	Modified float64 `json:"modified"`
+	Muted    bool    `json:"muted"`
+	With     struct {
+		Type            string `json:"type"`
+		Iden            string `json:"iden"`
+		Name            string `json:"name"`
+		Email           string `json:"email"`
+		EmailNormalized string `json:"email_normalized"`
+		ImageUrl        string `json:"image_url"`
+	} `json:"with"`
+}
+
+type Chats struct {
+	Chats []Chat `json:"chats"`
+}
+
 type Push struct {
-	Iden                    string `json:"iden"`
-	Type                    string `json:"type"`
-	Title                   string `json:"title"`
-	Body                    string `json:"body"`
-	Url                     string `json:"url"`
-	Active                  bool   `json:"active"`
-	Dismissed               bool   `json:"dismissed"`
-	SenderIden              string `json:"sender_iden"`
-	SenderEmail             string `json:"sender_email"`
-	SenderEmailNormalized   string `json:"sender_email_normalized"`
-	ReceiverIden            string `json:"receiver_iden"`
-	ReceiverEmail           string `json:"receiver_email"`
-	ReceiverEmailNormalized string `json:"receiver_email_normalized"`
+	Iden                    string  `json:"iden"`
+	Guid                    string  `json:"guid"`
+	Created                 float64 `json:"created"`
+	Modified                float64 `json:"modified"`
+	Type                    string  `json:"type"`
+	Title                   string  `json:"title"`
+	Body                    string  `json:"body"`
+	Url                     string  `json:"url"`
+	FileName                string  `json:"file_name"`
+	FileType                string  `json:"file_type"`
+	FileUrl                 string  `json:"file_url"`
+	ImageUrl                string  `json:"image_url"`
+	Active                  bool    `json:"active"`
+	Dismissed               bool    `json:"dismissed"`
+	SenderIden              string  `json:"sender_iden"`
+	SenderName              string  `json:"sender_name"`
+	SenderEmail             string  `json:"sender_email"`
+	SenderEmailNormalized   string  `json:"sender_email_normalized"`
+	ReceiverIden            string  `json:"receiver_iden"`
+	ReceiverEmail           string  `json:"receiver_email"`
+	ReceiverEmailNormalized string  `json:"receiver_email_normalized"`
+	TargetDeviceIden        string  `json:"target_device_iden"`
+	SourceDeviceIden        string  `json:"source_device_iden"`
 }
 
 type Pushes struct {
 	Pushes []Push `json:"pushes"`
+	Cursor string `json:"cursor"`
+}
+
+// Time converts a timestamp of the API, such as Push.Created, in seconds
+// since the Unix epoch.
+func Time(timestamp float64) time.Time {
+	return time.Unix(0, int64(timestamp*float64(time.Second)))
+}
+
+// Timestamp converts t to a timestamp of the API, such as the
+// modified_after parameter of GetPushes.
+func Timestamp(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
 }
 
 type User struct {
@@ -105,6 +154,34 @@ type UploadRequest struct {
 type Client struct {
 	token      string
 	HttpClient *http.Client
+	// BaseURL is the root of the API, "https://api.pushbullet.com/v2/"
+	// if empty.
+	BaseURL string
+	// MaxRetries is the number of times a failed request is retried.
+	MaxRetries int
+	// Logger receives debug records for every API call. The access token
+	// is redacted from all records. A nil Logger disables logging.
+	Logger *slog.Logger
+	// Observer is notified around every API call. A nil Observer
+	// disables instrumentation.
+	Observer Observer
+	// Cache, if set, serves repeated GetMe, GetDevices and GetChannel
+	// calls from memory.
+	Cache *Cache
+	// StreamURL is the realtime event stream,
+	// "wss://stream.pushbullet.com/websocket/" if empty.
+	StreamURL string
+	// DeviceFile is where EnsureDevice keeps the identity of the device of
+	// the program. If empty, it is a file named after the model in
+	// pushbullet/devices in the user config directory.
+	DeviceFile string
+
+	mu        sync.Mutex
+	rateLimit RateLimit
+	resolver  *Resolver
+	device    string
+	// Derived by SetEncryptionPassword.
+	encryptionKey []byte
 }
 
 type Params map[string]interface{}
@@ -113,5 +190,5 @@ type Endpoint map[string]string
 
 func NewClient(token string) *Client {
 	httpClient := &http.Client{}
-	return &Client{token: token, HttpClient: httpClient}
+	return &Client{token: token, HttpClient: httpClient, BaseURL: v2Api, MaxRetries: DefaultMaxRetries}
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+
+	"github.com/lucasweiblen/pushbulletclient/agent"
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+func runAgent(ctx context.Context, cli *client.Client, args []string) error {
+	fs := flagSet("agent")
+	hostname, _ := os.Hostname()
+	nickname := fs.String("nickname", hostname, "`nickname` of the device of the agent")
+	audit := fs.String("audit", "", "append the audit log to this `file` (default standard error)")
+	dismiss := fs.Bool("dismiss", false, "dismiss requests once replied to")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *nickname == "" {
+		fs.Usage()
+		return errUsage
+	}
+	cfg, err := agent.LoadConfig(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	out := os.Stderr
+	if *audit != "" {
+		out, err = os.OpenFile(*audit, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	device, err := cli.EnsureDevice(ctx, *nickname, "system", "pb agent")
+	if err != nil {
+		return err
+	}
+	a := agent.New(cli, cfg)
+	a.Audit = slog.New(slog.NewJSONHandler(out, nil))
+	a.Bot.Dismiss = *dismiss
+	log.Printf("serving %d commands as device %s (%s)", len(cfg.Commands), device.Nickname, device.Iden)
+	return a.Run(ctx)
+}
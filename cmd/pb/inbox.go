@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+	"github.com/lucasweiblen/pushbulletclient/inbox"
+)
+
+func runInbox(ctx context.Context, cli *client.Client, args []string) error {
+	fs := flagSet("inbox")
+	device := fs.String("device", "", "only save files pushed to the device with this `name` or iden")
+	register := fs.String("register", "", "register a device with this `nickname` and save the files pushed to it")
+	layout := fs.String("layout", string(inbox.Flat), "directory `layout`: flat, date, sender or type")
+	dismiss := fs.Bool("dismiss", false, "dismiss pushes once their file is saved")
+	state := fs.String("state", "", "state `file` (default dir/.pushbullet-inbox.json)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	switch inbox.Layout(*layout) {
+	case inbox.Flat, inbox.ByDate, inbox.BySender, inbox.ByType:
+	default:
+		fs.Usage()
+		return errUsage
+	}
+	dir := fs.Arg(0)
+	if *state == "" {
+		*state = filepath.Join(dir, ".pushbullet-inbox.json")
+	}
+	in, err := inbox.New(cli, dir, *state)
+	if err != nil {
+		return err
+	}
+	switch {
+	case *register != "":
+		d, err := cli.EnsureDevice(ctx, *register, "system", "pb inbox")
+		if err != nil {
+			return err
+		}
+		in.Device = d.Iden
+	case *device != "":
+		d, err := cli.Resolver().Device(ctx, *device)
+		if err != nil {
+			return err
+		}
+		in.Device = d.Iden
+	}
+	in.Layout = inbox.Layout(*layout)
+	in.Dismiss = *dismiss
+	in.OnDownload = func(push client.Push, path string, err error) {
+		if err != nil {
+			log.Printf("%s: %v", push.FileName, err)
+			return
+		}
+		log.Printf("saved %s", path)
+	}
+	log.Printf("saving files into %s", dir)
+	return in.Run(ctx)
+}
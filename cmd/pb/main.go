@@ -0,0 +1,139 @@
+// Command pb is a command line client for Pushbullet.
+//
+// Usage:
+//
+//	pb [-token token] <command> [arguments]
+//
+// The access token is taken from -token or the PUSHBULLET_TOKEN environment
+// variable. Run "pb <command> -h" for the arguments of a command.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, cli *client.Client, args []string) error
+}
+
+// Returned by commands called with invalid arguments, after printing
+// their usage.
+var errUsage = errors.New("invalid arguments")
+
+var commands []command
+
+// Set in init since the commands refer to the list for their usage.
+func init() {
+	commands = []command{
+		{"watch", "[-device name | -email address | -channel tag] [-state file] [-settle duration] dir", "push the files dropped into a directory", runWatch},
+		{"inbox", "[-device name | -register nickname] [-layout flat|date|sender|type] [-dismiss] [-state file] dir", "save the files pushed to a device", runInbox},
+		{"run", "[-device name | -email address | -channel tag] [-notify always|failure|success] [-tail lines] [-title title] -- command [arguments]", "run a command and push its result", runRun},
+		{"agent", "[-nickname name] [-audit file] [-dismiss] config", "run configured commands pushed as \"run <name>\"", runAgent},
+		{"serve", "[-addr address] [-config file | -device name | -email address | -channel tag] alertmanager", "receive Alertmanager webhooks and push the alerts", runServe},
+	}
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("pb: ")
+	token := flag.String("token", os.Getenv("PUSHBULLET_TOKEN"), "Pushbullet access token")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := findCommand(flag.Arg(0))
+	if !ok {
+		log.Printf("unknown command %q", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+	if *token == "" {
+		log.Fatal("no access token: set PUSHBULLET_TOKEN or pass -token")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	cli := client.NewClient(*token)
+	err := cmd.run(ctx, cli, flag.Args()[1:])
+	var status exitStatus
+	switch {
+	case errors.Is(err, errUsage):
+		os.Exit(2)
+	case errors.As(err, &status):
+		os.Exit(int(status))
+	case err != nil && !errors.Is(err, context.Canceled):
+		log.Fatal(err)
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: pb [-token token] <command> [arguments]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+}
+
+// Returns the flag set of a command.
+func flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		cmd, _ := findCommand(name)
+		fmt.Fprintf(os.Stderr, "usage: pb %s %s\n\n%s\n\n", cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// Target flags of the commands that push.
+type target struct {
+	device  string
+	email   string
+	channel string
+}
+
+func (t *target) register(fs *flag.FlagSet) {
+	fs.StringVar(&t.device, "device", "", "push to the device with this `name` or iden")
+	fs.StringVar(&t.email, "email", "", "push to this email `address`")
+	fs.StringVar(&t.channel, "channel", "", "push to the channel with this `tag`")
+}
+
+// Returns the params targeting the pushes, none to push to all devices.
+func (t *target) params(ctx context.Context, cli *client.Client) (client.Params, error) {
+	params := client.Params{}
+	switch {
+	case t.device != "":
+		device, err := cli.Resolver().Device(ctx, t.device)
+		if err != nil {
+			return nil, err
+		}
+		params["device_iden"] = device.Iden
+	case t.email != "":
+		params["email"] = t.email
+	case t.channel != "":
+		params["channel_tag"] = t.channel
+	}
+	return params, nil
+}
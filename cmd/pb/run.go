@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+// Size of the end of the log searched for the tail of the output.
+const tailBytes = 64 << 10
+
+// Exit status of a command run by pb run, which pb exits with.
+type exitStatus int
+
+func (s exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(s))
+}
+
+func runRun(ctx context.Context, cli *client.Client, args []string) error {
+	fs := flagSet("run")
+	var t target
+	t.register(fs)
+	notify := fs.String("notify", "always", "when to push: always, failure or success")
+	tail := fs.Int("tail", 20, "number of `lines` of output in the note")
+	title := fs.String("title", "", "`title` of the note (default the command line)")
+	fs.Parse(args)
+	if fs.NArg() == 0 || (*notify != "always" && *notify != "failure" && *notify != "success") {
+		fs.Usage()
+		return errUsage
+	}
+	argv := fs.Args()
+	if *title == "" {
+		*title = strings.Join(argv, " ")
+	}
+	params, err := t.params(ctx, cli)
+	if err != nil {
+		return err
+	}
+
+	logFile, err := os.CreateTemp("", "pb-run-*.log")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(logFile.Name())
+	defer logFile.Close()
+
+	// Signals stopping pb, such as from kill or systemd, are forwarded to
+	// the command as SIGTERM; pb waits for it and still reports how it
+	// ended.
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = io.MultiWriter(os.Stdout, logFile)
+	cmd.Stderr = io.MultiWriter(os.Stderr, logFile)
+	start := time.Now()
+	err = cmd.Run()
+	duration := time.Since(start).Round(time.Millisecond)
+	if cmd.ProcessState == nil {
+		// The command did not start: nothing to report.
+		return err
+	}
+	how, detail, code := ended(cmd.ProcessState)
+
+	failed := code != 0
+	if !notifies(*notify, failed) {
+		return exitCode(code)
+	}
+	hostname, _ := os.Hostname()
+	status := "succeeded"
+	if failed {
+		status = fmt.Sprintf("failed (%s %s)", how, detail)
+	}
+	params["type"] = "note"
+	params["title"] = *title + " " + status
+	params["body"] = fmt.Sprintf("host: %s\n%s: %s\nduration: %s\n\n%s", hostname, how, detail, duration, lastLines(logFile, *tail))
+	if failed {
+		params["type"] = "file"
+		params["file_name"] = fmt.Sprintf("pb-run-%s.log", start.UTC().Format("20060102T150405Z"))
+		params["file_type"] = "text/plain"
+	}
+
+	// Interrupts stopping the command must not prevent the notification.
+	pushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+	if failed {
+		fileUrl, err := cli.PushFile(pushCtx, params["file_name"].(string), "text/plain", logFile.Name())
+		if err != nil {
+			log.Printf("attaching the log: %v", err)
+			params["type"] = "note"
+		} else {
+			params["file_url"] = fileUrl
+		}
+	}
+	if _, err := cli.CreatePush(pushCtx, params); err != nil {
+		log.Printf("pushing the result: %v", err)
+	}
+	return exitCode(code)
+}
+
+// Reports whether the -notify policy notify pushes the result of a command
+// that failed or not.
+func notifies(notify string, failed bool) bool {
+	switch notify {
+	case "failure":
+		return failed
+	case "success":
+		return !failed
+	}
+	return true
+}
+
+// Returns how the command of state ended, "exit" or "signal", with the exit
+// status or the signal, and the code pb exits with: 128 plus the signal for
+// a command killed by one, as shells do.
+func ended(state *os.ProcessState) (how, detail string, code int) {
+	status, ok := state.Sys().(interface {
+		Signaled() bool
+		Signal() syscall.Signal
+	})
+	if ok && status.Signaled() {
+		return "signal", status.Signal().String(), 128 + int(status.Signal())
+	}
+	return "exit", strconv.Itoa(state.ExitCode()), state.ExitCode()
+}
+
+// Returns nil for 0, the exitStatus otherwise.
+func exitCode(code int) error {
+	if code == 0 {
+		return nil
+	}
+	return exitStatus(code)
+}
+
+// Returns the last n lines of the file f.
+func lastLines(f *os.File, n int) string {
+	info, err := f.Stat()
+	if err != nil || n <= 0 {
+		return ""
+	}
+	offset := max(info.Size()-tailBytes, 0)
+	data := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(data, offset); err != nil && err != io.EOF {
+		return ""
+	}
+	lines := bytes.Split(bytes.TrimRight(data, "\n"), []byte("\n"))
+	if offset > 0 && len(lines) > 1 {
+		// The first line is likely cut.
+		lines = lines[1:]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return string(bytes.Join(lines, []byte("\n")))
+}
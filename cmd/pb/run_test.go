@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/pbtest"
+)
+
+func TestLastLines(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "run.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString("one\ntwo\nthree\n")
+	if got := lastLines(f, 2); got != "two\nthree" {
+		t.Errorf("Expected the last 2 lines, got %q", got)
+	}
+	if got := lastLines(f, 10); got != "one\ntwo\nthree" {
+		t.Errorf("Expected every line, got %q", got)
+	}
+	if got := lastLines(f, 0); got != "" {
+		t.Errorf("Expected no lines, got %q", got)
+	}
+
+	// Only the end of a long log is read, without its cut first line.
+	f.WriteString(strings.Repeat("x", tailBytes) + "\n")
+	for i := 0; i < 3; i++ {
+		f.WriteString("line " + strconv.Itoa(i) + "\n")
+	}
+	if got := lastLines(f, 10); got != "line 0\nline 1\nline 2" {
+		t.Errorf("Expected the lines after the cut one, got %q", got)
+	}
+}
+
+func TestNotifies(t *testing.T) {
+	tests := []struct {
+		notify string
+		failed bool
+		want   bool
+	}{
+		{"always", false, true},
+		{"always", true, true},
+		{"failure", false, false},
+		{"failure", true, true},
+		{"success", false, true},
+		{"success", true, false},
+	}
+	for _, test := range tests {
+		if got := notifies(test.notify, test.failed); got != test.want {
+			t.Errorf("Expected -notify %s with failed %v to push %v, got %v", test.notify, test.failed, test.want, got)
+		}
+	}
+}
+
+func TestEnded(t *testing.T) {
+	cmd := exec.Command("/bin/sh", "-c", "exit 3")
+	cmd.Run()
+	if how, detail, code := ended(cmd.ProcessState); how != "exit" || detail != "3" || code != 3 {
+		t.Errorf("Expected exit 3, got %s %s, %d", how, detail, code)
+	}
+	cmd = exec.Command("/bin/sh", "-c", "kill -TERM $$")
+	cmd.Run()
+	if how, detail, code := ended(cmd.ProcessState); how != "signal" || detail != "terminated" || code != 143 {
+		t.Errorf("Expected signal terminated, got %s %s, %d", how, detail, code)
+	}
+}
+
+func TestRunForwardsSignal(t *testing.T) {
+	server := pbtest.NewServer()
+	defer server.Close()
+	ready := filepath.Join(t.TempDir(), "ready")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for {
+			if _, err := os.Stat(ready); err == nil {
+				cancel()
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	err := runRun(ctx, server.Client(), []string{"-email", "oncall@example.com", "-title", "job",
+		"/bin/sh", "-c", "trap 'kill $!; exit 7' TERM; sleep 10 & touch " + ready + "; wait"})
+	var status exitStatus
+	if !errors.As(err, &status) || status != 7 {
+		t.Fatalf("Expected the exit status of the command, got %v", err)
+	}
+	if pushes := server.Pushes(); len(pushes) != 1 || pushes[0].Title != "job failed (exit 7)" {
+		t.Errorf("Expected the failure pushed, got %#v", pushes)
+	}
+}
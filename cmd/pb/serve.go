@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/alertmanager"
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+func runServe(ctx context.Context, cli *client.Client, args []string) error {
+	fs := flagSet("serve")
+	var t target
+	t.register(fs)
+	addr := fs.String("addr", "localhost:9094", "listen `address`")
+	config := fs.String("config", "", "routes and templates `file`; without it every alert goes to the target flags")
+	fs.Parse(args)
+	if fs.NArg() != 1 || fs.Arg(0) != "alertmanager" {
+		fs.Usage()
+		return errUsage
+	}
+
+	cfg := &alertmanager.Config{}
+	if *config != "" {
+		var err error
+		if cfg, err = alertmanager.LoadConfig(*config); err != nil {
+			return err
+		}
+	} else {
+		route := alertmanager.Route{}
+		switch {
+		case t.device != "":
+			route.Targets = append(route.Targets, alertmanager.Target{Device: t.device})
+		case t.email != "":
+			route.Targets = append(route.Targets, alertmanager.Target{Email: t.email})
+		case t.channel != "":
+			route.Targets = append(route.Targets, alertmanager.Target{Channel: t.channel})
+		default:
+			fs.Usage()
+			return errUsage
+		}
+		cfg.Routes = []alertmanager.Route{route}
+	}
+	receiver, err := alertmanager.New(cli, cfg)
+	if err != nil {
+		return err
+	}
+	receiver.OnNotify = func(n *alertmanager.Notification, results []client.PushResult, err error) {
+		for _, result := range results {
+			if result.Err != nil {
+				log.Printf("%s: %d %s alerts: %v", result.Target, len(n.Alerts), n.Status, result.Err)
+			} else {
+				log.Printf("%s: %d %s alerts", result.Target, len(n.Alerts), n.Status)
+			}
+		}
+	}
+
+	server := &http.Server{Addr: *addr, Handler: receiver, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	log.Printf("receiving Alertmanager notifications on %s", *addr)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return ctx.Err()
+}
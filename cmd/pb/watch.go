@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+	"github.com/lucasweiblen/pushbulletclient/watch"
+)
+
+func runWatch(ctx context.Context, cli *client.Client, args []string) error {
+	fs := flagSet("watch")
+	var t target
+	t.register(fs)
+	state := fs.String("state", "", "state `file` recording the pushed files (default dir/.pushbullet-watch.json)")
+	settle := fs.Duration("settle", watch.DefaultSettle, "push files once unchanged for this `duration`")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	dir := fs.Arg(0)
+	if *state == "" {
+		*state = filepath.Join(dir, ".pushbullet-watch.json")
+	}
+	params, err := t.params(ctx, cli)
+	if err != nil {
+		return err
+	}
+	w, err := watch.New(cli, dir, *state, params)
+	if err != nil {
+		return err
+	}
+	w.Settle = *settle
+	w.OnPush = func(name string, push client.Push, err error) {
+		if err != nil {
+			log.Printf("%s: %v", name, err)
+			return
+		}
+		log.Printf("%s: pushed %s", name, push.Iden)
+	}
+	log.Printf("watching %s", dir)
+	return w.Run(ctx)
+}
@@ -0,0 +1,243 @@
+// Package inbox saves the files pushed to a device into a local directory
+// as they arrive.
+//
+// New pushes are detected through the realtime stream, with a periodic sync
+// as a safety net, and fetched with GetPushes and modified_after. The sync
+// position and the downloaded pushes are kept in a state file, so a
+// restarted inbox neither misses nor downloads files twice.
+//
+// Usage:
+//
+//	in, err := inbox.New(cli, "/srv/inbox", "/var/lib/inbox.json")
+//	if err != nil {
+//		log.Fatalln(err)
+//	}
+//	in.Device = "ujpah72o0"
+//	in.Layout = inbox.BySender
+//	in.Dismiss = true
+//	err = in.Run(ctx)
+package inbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+// Layout decides the subdirectory a file is saved to.
+type Layout string
+
+const (
+	// All files in the directory itself.
+	Flat Layout = "flat"
+	// Files in a directory per day, e.g. 2024-05-31.
+	ByDate Layout = "date"
+	// Files in a directory per sender email.
+	BySender Layout = "sender"
+	// Files in a directory per media type, e.g. image or application.
+	ByType Layout = "type"
+)
+
+// DefaultInterval is the time between syncs when no tickle arrives.
+const DefaultInterval = 5 * time.Minute
+
+// State is what an inbox remembers across restarts.
+type State struct {
+	// Modified of the newest push handled.
+	Modified float64 `json:"modified"`
+	// Paths of the downloaded files by push iden.
+	Downloaded map[string]string `json:"downloaded"`
+}
+
+// Inbox downloads incoming file pushes.
+type Inbox struct {
+	// Device restricts the inbox to pushes targeted at the device with
+	// this iden. Empty accepts the file pushes of every device.
+	Device string
+	Layout Layout
+	// Dismiss dismisses pushes once their file is saved.
+	Dismiss bool
+	// Since skips pushes older than it on the first sync, when there is no
+	// state yet. Zero downloads every active file push.
+	Since time.Time
+	// Interval between syncs without tickles.
+	Interval time.Duration
+	// OnDownload, if set, is called after every attempt to save a file.
+	OnDownload func(push client.Push, path string, err error)
+
+	client    *client.Client
+	dir       string
+	statePath string
+	mu        sync.Mutex
+	state     State
+}
+
+// New returns an Inbox saving files into dir, with its state in the file
+// at statePath.
+func New(c *client.Client, dir, statePath string) (*Inbox, error) {
+	in := &Inbox{
+		Layout:    Flat,
+		Interval:  DefaultInterval,
+		client:    c,
+		dir:       dir,
+		statePath: statePath,
+		state:     State{Downloaded: map[string]string{}},
+	}
+	data, err := os.ReadFile(statePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &in.state); err != nil {
+			return nil, fmt.Errorf("inbox: reading state: %w", err)
+		}
+		if in.state.Downloaded == nil {
+			in.state.Downloaded = map[string]string{}
+		}
+	}
+	return in, nil
+}
+
+// State returns the current state.
+func (in *Inbox) State() State {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	state := State{Modified: in.state.Modified, Downloaded: map[string]string{}}
+	for iden, path := range in.state.Downloaded {
+		state.Downloaded[iden] = path
+	}
+	return state
+}
+
+// Run syncs on every push tickle of the realtime stream and every Interval,
+// until ctx is done. Failed syncs are retried at the next occasion; Run only
+// returns early if the API rejects the access token.
+func (in *Inbox) Run(ctx context.Context) error {
+	return in.client.SyncOnTickles(ctx, in.Interval, in.Sync)
+}
+
+// Sync downloads the file pushes that arrived since the last sync, oldest
+// first. It stops at the first file failing with a transient error, which is
+// returned and retried by the next sync.
+func (in *Inbox) Sync(ctx context.Context) error {
+	in.mu.Lock()
+	params := client.Params{}
+	switch {
+	case in.state.Modified > 0:
+		params["modified_after"] = in.state.Modified
+	case !in.Since.IsZero():
+		params["modified_after"] = client.Timestamp(in.Since)
+		params["active"] = true
+	default:
+		params["active"] = true
+	}
+	in.mu.Unlock()
+
+	pushes, err := in.client.GetPushes(ctx, params)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(pushes, func(i, j int) bool {
+		return pushes[i].Modified < pushes[j].Modified
+	})
+	for _, push := range pushes {
+		if in.wanted(push) {
+			path, err := in.download(ctx, push)
+			if in.OnDownload != nil {
+				in.OnDownload(push, path, err)
+			}
+			if err != nil && !client.IsPermanent(err) {
+				return err
+			}
+			if err == nil && in.Dismiss {
+				// Dismissal failures are not worth downloading again.
+				in.client.UpdatePush(ctx, client.Params{"iden": push.Iden, "dismissed": true})
+			}
+		}
+		if err := in.advance(push); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reports whether push is a file push for the inbox not yet downloaded.
+func (in *Inbox) wanted(push client.Push) bool {
+	if !push.Active || push.Type != "file" || push.FileUrl == "" {
+		return false
+	}
+	if in.Device != "" && push.TargetDeviceIden != in.Device {
+		return false
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	_, done := in.state.Downloaded[push.Iden]
+	return !done
+}
+
+func (in *Inbox) download(ctx context.Context, push client.Push) (string, error) {
+	dir := filepath.Join(in.dir, in.subdir(push))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	path, err := in.client.DownloadFile(ctx, push, dir)
+	if err != nil {
+		return "", err
+	}
+	in.mu.Lock()
+	in.state.Downloaded[push.Iden] = path
+	in.mu.Unlock()
+	return path, nil
+}
+
+// Records push as handled and saves the state.
+func (in *Inbox) advance(push client.Push) error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if push.Modified > in.state.Modified {
+		in.state.Modified = push.Modified
+	}
+	data, err := json.MarshalIndent(in.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := in.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, in.statePath)
+}
+
+// Returns the directory of push relative to the inbox, following Layout.
+func (in *Inbox) subdir(push client.Push) string {
+	var name string
+	switch in.Layout {
+	case ByDate:
+		created := client.Time(push.Created)
+		name = created.Format("2006-01-02")
+	case BySender:
+		name = push.SenderEmailNormalized
+		if name == "" {
+			name = push.SenderEmail
+		}
+		if name == "" {
+			name = push.SenderName
+		}
+	case ByType:
+		name, _, _ = strings.Cut(push.FileType, "/")
+	default:
+		return ""
+	}
+	if name = client.SanitizeFileName(name); name == "" {
+		name = "unknown"
+	}
+	return name
+}
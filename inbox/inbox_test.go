@@ -0,0 +1,128 @@
+package inbox
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+	"github.com/lucasweiblen/pushbulletclient/pbtest"
+)
+
+func TestSync(t *testing.T) {
+	server := pbtest.NewServer()
+	defer server.Close()
+	cli := server.Client()
+	photo := server.AddFile("photo.jpg", []byte("a photo"))
+	other := server.AddFile("other.pdf", []byte("a document"))
+	missing := strings.TrimSuffix(server.URL, "/v2/") + "/files/missing"
+	server.AddPush(client.Push{Type: "file", Active: true, TargetDeviceIden: "phone",
+		FileName: "other.pdf", FileUrl: other})
+	server.AddPush(client.Push{Type: "note", Active: true, TargetDeviceIden: "server"})
+	p3 := server.AddPush(client.Push{Type: "file", Active: true, TargetDeviceIden: "server",
+		SenderEmail: "Alice@example.com", SenderEmailNormalized: "alice@example.com",
+		FileName: "photo.jpg", FileType: "image/jpeg", FileUrl: photo})
+	p4 := server.AddPush(client.Push{Type: "file", Active: true, TargetDeviceIden: "server",
+		FileName: "gone.txt", FileUrl: missing})
+
+	dir := t.TempDir()
+	state := filepath.Join(t.TempDir(), "state.json")
+	in, err := New(cli, dir, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.Device = "server"
+	in.Layout = BySender
+	in.Dismiss = true
+	if err := in.Sync(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	path := filepath.Join(dir, "alice@example.com", "photo.jpg")
+	if data, err := os.ReadFile(path); err != nil || string(data) != "a photo" {
+		t.Errorf("Expected photo in %s, got %q, %v", path, data, err)
+	}
+	if files := downloaded(dir); len(files) != 1 {
+		t.Errorf("Expected only the photo downloaded, got %v", files)
+	}
+	var dismissed []string
+	for _, push := range server.Pushes() {
+		if push.Dismissed {
+			dismissed = append(dismissed, push.Iden)
+		}
+	}
+	if len(dismissed) != 1 || dismissed[0] != p3.Iden {
+		t.Errorf("Expected %s to be dismissed, got %v", p3.Iden, dismissed)
+	}
+	if s := in.State(); s.Modified != p4.Modified || s.Downloaded[p3.Iden] != path {
+		t.Errorf("Unexpected state %#v", s)
+	}
+
+	// A restarted inbox resumes after the newest push.
+	in, err = New(cli, dir, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	fileUrl := server.AddFile("new.txt", []byte("a new file"))
+	p5 := server.AddPush(client.Push{Type: "file", Active: true, FileName: "new.txt", FileUrl: fileUrl})
+	in.Sync(context.Background())
+	if _, err := os.Stat(path); err == nil {
+		t.Errorf("Expected the photo not to be downloaded again")
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "new.txt")); err != nil || string(data) != "a new file" {
+		t.Errorf("Expected the new push downloaded, got %q, %v", data, err)
+	}
+	if s := in.State(); s.Modified != p5.Modified {
+		t.Errorf("Expected sync up to the new push, got %#v", s)
+	}
+}
+
+// Returns the completed downloads under dir.
+func downloaded(dir string) []string {
+	var files []string
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && !strings.HasSuffix(path, ".part") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
+
+func TestSubdir(t *testing.T) {
+	push := client.Push{Created: 1717171717, FileType: "application/pdf", SenderName: "../Bob"}
+	tests := map[Layout]string{
+		Flat:     "",
+		ByDate:   "2024-05-31",
+		ByType:   "application",
+		BySender: "Bob",
+	}
+	for layout, want := range tests {
+		in := &Inbox{Layout: layout}
+		if got := in.subdir(push); got != want {
+			t.Errorf("Expected %s layout to give %q, got %q", layout, want, got)
+		}
+	}
+}
+
+func TestRunRejectedToken(t *testing.T) {
+	server := pbtest.NewServer()
+	defer server.Close()
+	cli := client.NewClient("invalid")
+	cli.BaseURL = server.URL
+	cli.StreamURL = server.StreamURL
+	in, err := New(cli, t.TempDir(), filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = in.Run(context.Background())
+	httpErr, ok := err.(*client.HttpError)
+	if !ok || httpErr.Status != http.StatusUnauthorized {
+		t.Errorf("Expected unauthorized error, got %v", err)
+	}
+}
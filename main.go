@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 
@@ -8,9 +9,11 @@ import (
 )
 
 func main() {
+	ctx := context.Background()
+
 	//200
 	cli := client.NewClient("swbpcaTIjyV5eAYZnjfL2GZqFiiqrBHH")
-	user, err := cli.GetMe()
+	user, err := cli.GetMe(ctx)
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -18,19 +21,19 @@ func main() {
 
 	//400
 	cli2 := client.NewClient("foo")
-	_, err = cli2.GetMe()
+	_, err = cli2.GetMe(ctx)
 	if err != nil {
 		fmt.Println(err)
 	}
 
 	// returns error -> no channel tag parameter
-	_, err = cli.Subscribe(client.Params{})
+	_, err = cli.Subscribe(ctx, client.Params{})
 	if err != nil {
 		fmt.Println(err)
 	}
 
 	//subscribe to channel tag
-	subscription, err := cli.Subscribe(client.Params{"channel_tag": "jblow"})
+	subscription, err := cli.Subscribe(ctx, client.Params{"channel_tag": "jblow"})
 	if err != nil {
 		//	log.Fatalln(err)
 		fmt.Println(err)
@@ -38,21 +41,21 @@ func main() {
 	fmt.Println(subscription)
 
 	//getting subscriptions
-	subs, err := cli.Subscriptions()
+	subs, err := cli.Subscriptions(ctx)
 	if err != nil {
 		//	log.Fatalln(err)
 		fmt.Println(err)
 	}
 	fmt.Println(subs)
 
-	ch, err := cli.GetChannel(client.Params{"tag": "jblow"})
+	ch, err := cli.GetChannel(ctx, client.Params{"tag": "jblow"})
 	if err != nil {
 		fmt.Println(err)
 	}
 	fmt.Println(ch)
 
 	//removing subscription
-	//err = cli.Unsubscribe2(client.Params{"iden": "ujvSxVpCjh6sjAgWOzmngO"})
+	//err = cli.Unsubscribe2(ctx, client.Params{"iden": "ujvSxVpCjh6sjAgWOzmngO"})
 	//if err != nil {
 	//fmt.Println(err)
 	//return
@@ -60,35 +63,35 @@ func main() {
 	//fmt.Println("subscription removed with sucess")
 
 	fmt.Println("----------")
-	contacts, err := cli.GetContacts()
+	contacts, err := cli.GetContacts(ctx)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 	fmt.Println(contacts)
 
-	//contact, err := cli.CreateContact(client.Params{"name": "joao", "email": "joao@foo.com"})
+	//contact, err := cli.CreateContact(ctx, client.Params{"name": "joao", "email": "joao@foo.com"})
 	//if err != nil {
 	//fmt.Println(err)
 	//return
 	//}
 	//fmt.Println(contact)
 
-	//err = cli.DeleteContact(client.Params{"iden": "ujvSxVpCjh6sjArHrh8WLA"})
+	//err = cli.DeleteContact(ctx, client.Params{"iden": "ujvSxVpCjh6sjArHrh8WLA"})
 	//if err != nil {
 	//fmt.Println(err)
 	//return
 	//}
 	//fmt.Println("Removed")
 
-	//_, err = cli.CreateDevice(client.Params{"nickname": "foobar"})
+	//_, err = cli.CreateDevice(ctx, client.Params{"nickname": "foobar"})
 	//if err != nil {
 	//fmt.Println(err)
 	//}
-	devices, _ := cli.GetDevices()
+	devices, _ := cli.GetDevices(ctx)
 	fmt.Println(devices)
 
-	//newReq, err := cli.UploadRequest(client.Params{"file_name": "teste", "file_type": "text"})
+	//newReq, err := cli.UploadRequest(ctx, client.Params{"file_name": "teste", "file_type": "text"})
 	//if err != nil {
 	//fmt.Println(err)
 	//return
@@ -98,13 +101,13 @@ func main() {
 	//fmt.Println(newReq.FileName)
 	//fmt.Println(newReq.FileUrl)
 
-	//err = cli.Upload("teste.txt", "text/plain", "teste.txt")
+	//err = cli.Upload(ctx, "teste.txt", "text/plain", "teste.txt")
 	//if err != nil {
 	//fmt.Println(err)
 	//return
 	//}
 	//fmt.Println("OK")
-	push, err := cli.CreatePush(client.Params{
+	push, err := cli.CreatePush(ctx, client.Params{
 		"type":      "file",
 		"file_name": "teste.txt",
 		"file_type": "text/plain",
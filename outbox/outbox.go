@@ -0,0 +1,442 @@
+// Package outbox queues pushes on disk and sends them once the Pushbullet
+// API can be reached, so notifications created while offline are not lost.
+//
+// Usage:
+//
+//	box, err := outbox.Open(cli, "/var/lib/myapp/outbox.jsonl")
+//	if err != nil {
+//		log.Fatalln(err)
+//	}
+//	defer box.Close()
+//	go box.Run(ctx)
+//	box.Push(client.Params{"type": "note", "title": "backup done"})
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+// Kinds of queued operations.
+const (
+	KindPush = "push"
+	KindFile = "file"
+)
+
+var unknownEntryError = errors.New("outbox: unknown entry")
+
+// Entry is an operation waiting in the outbox.
+type Entry struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	// Params of the push. Their guid is the ID of the entry: a replay
+	// after a failed attempt or a crash first looks the push up by guid,
+	// so it is not created twice.
+	Params client.Params `json:"params"`
+	// Local file uploaded before creating a push of kind file.
+	Path     string    `json:"path,omitempty"`
+	Queued   time.Time `json:"queued"`
+	Attempts int       `json:"attempts"`
+	// Error of the last failed attempt.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Journal record. The outbox file is an append-only list of records, one
+// JSON object per line, replayed on Open.
+type record struct {
+	Op    string `json:"op"`
+	Entry *Entry `json:"entry,omitempty"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Outbox is a durable, ordered queue of pushes.
+type Outbox struct {
+	// MaxAttempts moves an entry to the failed list after that many
+	// transient failures. Zero retries forever.
+	MaxAttempts int
+	// Backoff is the first delay of Run after a failed send, doubled up to
+	// MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	client  *client.Client
+	path    string
+	mu      sync.Mutex
+	file    *os.File
+	pending []*Entry
+	failed  []*Entry
+	wake    chan struct{}
+	// Entries queued before are replays of a previous run.
+	opened time.Time
+}
+
+// Open loads the outbox stored at path, creating it if needed.
+func Open(c *client.Client, path string) (*Outbox, error) {
+	o := &Outbox{
+		Backoff:    time.Second,
+		MaxBackoff: 5 * time.Minute,
+		client:     c,
+		path:       path,
+		wake:       make(chan struct{}, 1),
+		opened:     time.Now(),
+	}
+	if err := o.load(); err != nil {
+		return nil, err
+	}
+	if err := o.compact(); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	o.file = file
+	return o, nil
+}
+
+// Close closes the outbox file.
+func (o *Outbox) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.file.Close()
+}
+
+// Push queues a CreatePush with params.
+func (o *Outbox) Push(params client.Params) (Entry, error) {
+	return o.add(KindPush, params, "")
+}
+
+// PushFile queues the upload of the file at path followed by a file push
+// with params, which may set title, body or targets.
+//
+// Usage:
+//
+//	box.PushFile("scan.pdf", "application/pdf", "/tmp/scan.pdf", client.Params{"device_iden": "0xyz"})
+func (o *Outbox) PushFile(filename, filetype, path string, params client.Params) (Entry, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return Entry{}, err
+	}
+	p := client.Params{}
+	for k, v := range params {
+		p[k] = v
+	}
+	p["type"] = "file"
+	p["file_name"] = filename
+	p["file_type"] = filetype
+	return o.add(KindFile, p, path)
+}
+
+// Pending returns the entries waiting to be sent, in order.
+func (o *Outbox) Pending() []Entry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return copyEntries(o.pending)
+}
+
+// Failed returns the entries that failed permanently.
+func (o *Outbox) Failed() []Entry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return copyEntries(o.failed)
+}
+
+// Retry moves a failed entry back to the end of the queue.
+func (o *Outbox) Retry(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, e := range o.failed {
+		if e.ID == id {
+			if err := o.append(record{Op: "retry", ID: id}); err != nil {
+				return err
+			}
+			o.failed = append(o.failed[:i], o.failed[i+1:]...)
+			e.Attempts = 0
+			o.pending = append(o.pending, e)
+			o.notify()
+			return nil
+		}
+	}
+	return unknownEntryError
+}
+
+// Discard removes an entry, pending or failed, without sending it.
+func (o *Outbox) Discard(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.remove(id) {
+		return unknownEntryError
+	}
+	return o.append(record{Op: "done", ID: id})
+}
+
+// Flush sends the pending entries in order. It stops at the first
+// transient failure, which is returned, leaving the remaining entries
+// queued. Entries rejected by the API are moved to the failed list.
+func (o *Outbox) Flush(ctx context.Context) error {
+	for {
+		o.mu.Lock()
+		if len(o.pending) == 0 {
+			o.mu.Unlock()
+			return nil
+		}
+		entry := *o.pending[0]
+		o.mu.Unlock()
+
+		err := o.send(ctx, entry)
+		if err := o.finish(entry, err); err != nil {
+			return err
+		}
+		if err != nil && !permanent(err) {
+			return err
+		}
+	}
+}
+
+// Run flushes the outbox whenever entries are queued, backing off while
+// sends fail, until ctx is done.
+func (o *Outbox) Run(ctx context.Context) error {
+	backoff := o.Backoff
+	for {
+		var wait <-chan time.Time
+		if err := o.Flush(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			wait = time.After(backoff)
+			backoff *= 2
+			if backoff > o.MaxBackoff {
+				backoff = o.MaxBackoff
+			}
+		} else {
+			backoff = o.Backoff
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-o.wake:
+		case <-wait:
+		}
+	}
+}
+
+func (o *Outbox) send(ctx context.Context, entry Entry) error {
+	params := client.Params{}
+	for k, v := range entry.Params {
+		params[k] = v
+	}
+	if entry.Kind == KindFile {
+		fileUrl, err := o.client.PushFile(ctx, fmt.Sprint(params["file_name"]), fmt.Sprint(params["file_type"]), entry.Path)
+		if err != nil {
+			return err
+		}
+		params["file_url"] = fileUrl
+	}
+	var opts []client.RequestOption
+	if entry.Attempts > 0 || entry.Queued.Before(o.opened) {
+		// An attempt that failed or was cut short may have created the
+		// push; the minute covers clock skew with the API.
+		opts = append(opts, client.WithGUIDLookback(time.Since(entry.Queued)+time.Minute))
+	}
+	_, err := o.client.CreatePush(ctx, params, opts...)
+	return err
+}
+
+// Records the outcome of sending entry.
+func (o *Outbox) finish(entry Entry, sendErr error) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if sendErr == nil {
+		o.remove(entry.ID)
+		return o.append(record{Op: "done", ID: entry.ID})
+	}
+	e := o.find(entry.ID)
+	if e == nil {
+		return nil
+	}
+	e.Attempts++
+	e.LastError = sendErr.Error()
+	if err := o.append(record{Op: "attempt", ID: e.ID, Error: e.LastError}); err != nil {
+		return err
+	}
+	if permanent(sendErr) || (o.MaxAttempts > 0 && e.Attempts >= o.MaxAttempts) {
+		o.remove(e.ID)
+		o.failed = append(o.failed, e)
+		return o.append(record{Op: "fail", ID: e.ID})
+	}
+	return nil
+}
+
+func (o *Outbox) add(kind string, params client.Params, path string) (Entry, error) {
+	entry := &Entry{Kind: kind, Params: client.Params{}, Path: path, Queued: time.Now()}
+	for k, v := range params {
+		entry.Params[k] = v
+	}
+	if guid, ok := entry.Params["guid"].(string); ok && guid != "" {
+		entry.ID = guid
+	} else {
+		entry.ID = client.NewGUID()
+		entry.Params["guid"] = entry.ID
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.append(record{Op: "add", Entry: entry}); err != nil {
+		return Entry{}, err
+	}
+	o.pending = append(o.pending, entry)
+	o.notify()
+	return *entry, nil
+}
+
+// Appends rec to the journal and syncs it to disk.
+func (o *Outbox) append(rec record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err = o.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return o.file.Sync()
+}
+
+// Replays the journal. A truncated last line, left by a crash while
+// writing, is ignored.
+func (o *Outbox) load() error {
+	file, err := os.Open(o.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		o.apply(rec)
+	}
+	return scanner.Err()
+}
+
+func (o *Outbox) apply(rec record) {
+	switch rec.Op {
+	case "add":
+		if rec.Entry != nil {
+			o.pending = append(o.pending, rec.Entry)
+		}
+	case "attempt":
+		if e := o.find(rec.ID); e != nil {
+			e.Attempts++
+			e.LastError = rec.Error
+		}
+	case "fail":
+		if e := o.find(rec.ID); e != nil {
+			o.remove(rec.ID)
+			o.failed = append(o.failed, e)
+		}
+	case "retry":
+		for i, e := range o.failed {
+			if e.ID == rec.ID {
+				o.failed = append(o.failed[:i], o.failed[i+1:]...)
+				e.Attempts = 0
+				o.pending = append(o.pending, e)
+				break
+			}
+		}
+	case "done":
+		o.remove(rec.ID)
+	}
+}
+
+// Rewrites the journal with only the current entries.
+func (o *Outbox) compact() error {
+	tmp := o.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, e := range o.pending {
+		enc.Encode(record{Op: "add", Entry: e})
+	}
+	for _, e := range o.failed {
+		enc.Encode(record{Op: "add", Entry: e})
+		enc.Encode(record{Op: "fail", ID: e.ID})
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, o.path)
+}
+
+// Looks up a pending entry.
+func (o *Outbox) find(id string) *Entry {
+	for _, e := range o.pending {
+		if e.ID == id {
+			return e
+		}
+	}
+	return nil
+}
+
+// Removes an entry, pending or failed.
+func (o *Outbox) remove(id string) bool {
+	for i, e := range o.pending {
+		if e.ID == id {
+			o.pending = append(o.pending[:i], o.pending[i+1:]...)
+			return true
+		}
+	}
+	for i, e := range o.failed {
+		if e.ID == id {
+			o.failed = append(o.failed[:i], o.failed[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Reports whether err will not go away by retrying: the API rejected the
+// request, or the file to upload is missing.
+func permanent(err error) bool {
+	return client.IsPermanent(err) || errors.Is(err, os.ErrNotExist)
+}
+
+func copyEntries(entries []*Entry) []Entry {
+	out := make([]Entry, len(entries))
+	for i, e := range entries {
+		out[i] = *e
+	}
+	return out
+}
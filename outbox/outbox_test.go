@@ -0,0 +1,199 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+type fakeAPI struct {
+	mu     sync.Mutex
+	down   bool
+	reject bool
+	// Pushes are created but answered with an error.
+	lost    bool
+	pushes  []client.Params
+	uploads int
+}
+
+func (api *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if api.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	switch r.URL.Path {
+	case "/v2/pushes":
+		if r.Method == "GET" {
+			pushes := []client.Push{}
+			for i, params := range api.pushes {
+				pushes = append(pushes, client.Push{Iden: fmt.Sprintf("push%d", i+1), Guid: fmt.Sprint(params["guid"])})
+			}
+			json.NewEncoder(w).Encode(client.Pushes{Pushes: pushes})
+			return
+		}
+		if api.reject {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var params client.Params
+		json.NewDecoder(r.Body).Decode(&params)
+		api.pushes = append(api.pushes, params)
+		if api.lost {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprintf(w, `{"iden": "push%d"}`, len(api.pushes))
+	case "/v2/upload-request":
+		fmt.Fprintf(w, `{"file_url": "http://%s/files/scan.pdf", "upload_url": "http://%s/upload"}`, r.Host, r.Host)
+	case "/upload":
+		api.uploads++
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestOutbox(t *testing.T, api *fakeAPI, path string) *Outbox {
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+	cli := client.NewClient("foobar")
+	cli.BaseURL = server.URL + "/v2/"
+	cli.MaxRetries = 0
+	box, err := Open(cli, path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %#v", err)
+	}
+	t.Cleanup(func() { box.Close() })
+	return box
+}
+
+func TestOutboxOffline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	api := &fakeAPI{down: true}
+	box := newTestOutbox(t, api, path)
+	box.Push(client.Params{"type": "note", "title": "first"})
+	box.Push(client.Params{"type": "note", "title": "second"})
+	if err := box.Flush(context.Background()); err == nil {
+		t.Errorf("Expected error while offline")
+	}
+	pending := box.Pending()
+	if len(pending) != 2 || pending[0].Attempts != 1 || pending[0].LastError == "" || pending[1].Attempts != 0 {
+		t.Fatalf("Unexpected pending entries %#v", pending)
+	}
+	box.Close()
+
+	// Reopen, as after a restart, and come back online.
+	api.down = false
+	box = newTestOutbox(t, api, path)
+	if len(box.Pending()) != 2 {
+		t.Fatalf("Expected 2 pending entries after reopening, got %#v", box.Pending())
+	}
+	if err := box.Flush(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %#v", err)
+	}
+	if len(api.pushes) != 2 || api.pushes[0]["title"] != "first" || api.pushes[1]["title"] != "second" {
+		t.Errorf("Expected pushes in order, got %#v", api.pushes)
+	}
+	if api.pushes[0]["guid"] != pending[0].ID {
+		t.Errorf("Expected entry id as guid, got %#v", api.pushes[0])
+	}
+	box.Close()
+
+	box = newTestOutbox(t, api, path)
+	if len(box.Pending()) != 0 || len(box.Failed()) != 0 {
+		t.Errorf("Expected empty outbox, got %#v %#v", box.Pending(), box.Failed())
+	}
+}
+
+func TestOutboxLostResponse(t *testing.T) {
+	api := &fakeAPI{lost: true}
+	box := newTestOutbox(t, api, filepath.Join(t.TempDir(), "outbox.jsonl"))
+	box.Push(client.Params{"type": "note", "title": "backup done"})
+	if err := box.Flush(context.Background()); err == nil {
+		t.Errorf("Expected the lost response to fail the flush")
+	}
+	api.lost = false
+	if err := box.Flush(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(api.pushes) != 1 || len(box.Pending()) != 0 {
+		t.Errorf("Expected exactly one push, got %#v", api.pushes)
+	}
+}
+
+func TestOutboxFailed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	api := &fakeAPI{reject: true}
+	box := newTestOutbox(t, api, path)
+	entry, _ := box.Push(client.Params{"type": "note"})
+	if err := box.Flush(context.Background()); err != nil {
+		t.Errorf("Expected rejected entry not to stop the flush, got %#v", err)
+	}
+	failed := box.Failed()
+	if len(box.Pending()) != 0 || len(failed) != 1 || failed[0].ID != entry.ID {
+		t.Fatalf("Expected entry to fail, got %#v %#v", box.Pending(), failed)
+	}
+	box.Close()
+
+	api.reject = false
+	box = newTestOutbox(t, api, path)
+	if len(box.Failed()) != 1 {
+		t.Fatalf("Expected failed entry after reopening, got %#v", box.Failed())
+	}
+	if err := box.Retry(entry.ID); err != nil {
+		t.Fatalf("Expected no error, got %#v", err)
+	}
+	box.Flush(context.Background())
+	if len(api.pushes) != 1 || len(box.Failed()) != 0 {
+		t.Errorf("Expected retried entry to be sent, got %#v", api.pushes)
+	}
+}
+
+func TestOutboxPushFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "scan.pdf")
+	os.WriteFile(file, []byte("%PDF"), 0600)
+	api := &fakeAPI{}
+	box := newTestOutbox(t, api, filepath.Join(dir, "outbox.jsonl"))
+	box.PushFile("scan.pdf", "application/pdf", file, client.Params{"title": "scan"})
+	if err := box.Flush(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %#v", err)
+	}
+	if api.uploads != 1 || len(api.pushes) != 1 {
+		t.Fatalf("Expected 1 upload and 1 push, got %d and %#v", api.uploads, api.pushes)
+	}
+	push := api.pushes[0]
+	if push["type"] != "file" || push["title"] != "scan" || push["file_url"] == nil {
+		t.Errorf("Unexpected push %#v", push)
+	}
+}
+
+func TestOutboxRun(t *testing.T) {
+	api := &fakeAPI{}
+	box := newTestOutbox(t, api, filepath.Join(t.TempDir(), "outbox.jsonl"))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- box.Run(ctx) }()
+	box.Push(client.Params{"type": "note"})
+	for i := 0; len(box.Pending()) != 0 && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(box.Pending()) != 0 {
+		t.Errorf("Expected Run to send the queued push")
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %#v", err)
+	}
+}
@@ -0,0 +1,238 @@
+// Package pbcrash pushes a report when a program panics.
+//
+// The report is a file push to the target: the panic value, the stack of
+// the panicking goroutine, the binary version and the hostname in the body,
+// and the dump of every goroutine attached. It is sent synchronously,
+// within a time bound, before the panic resumes or the program exits.
+//
+// Usage:
+//
+//	func main() {
+//		pbcrash.Setup(cli, client.Params{"device_iden": "ujpah72o0"})
+//		defer pbcrash.Guard()
+//		...
+//		pbcrash.Go(worker)
+//	}
+package pbcrash
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+// DefaultTimeout bounds the report of a panic.
+const DefaultTimeout = 10 * time.Second
+
+// Size of the stack kept in the body of the report; the attached dump
+// has it in full.
+const maxStack = 8 << 10
+
+// Replaced by tests.
+var exit = os.Exit
+
+// Reporter reports the panics of the functions it guards.
+type Reporter struct {
+	// Params are added to the report, typically the target: device_iden
+	// or channel_tag.
+	Params client.Params
+	// Title prefixes the title of the report, the program name if empty.
+	Title string
+	// Timeout bounds the report, DefaultTimeout if zero.
+	Timeout time.Duration
+	// Exit makes the program exit with status 2 after the report instead
+	// of resuming the panic.
+	Exit bool
+	// OnError, if set, is called when the report fails.
+	OnError func(error)
+
+	client *client.Client
+	// Serializes reports of concurrent panics.
+	mu sync.Mutex
+}
+
+// New returns a Reporter pushing with c.
+func New(c *client.Client, params client.Params) *Reporter {
+	return &Reporter{Params: params, client: c}
+}
+
+var (
+	defaultMu       sync.Mutex
+	defaultReporter *Reporter
+)
+
+// Setup sets the Reporter used by Guard and Go, and returns it for further
+// configuration.
+func Setup(c *client.Client, params client.Params) *Reporter {
+	r := New(c, params)
+	defaultMu.Lock()
+	defaultReporter = r
+	defaultMu.Unlock()
+	return r
+}
+
+// Guard reports a panic with the Reporter of Setup. It must be deferred
+// directly:
+//
+//	defer pbcrash.Guard()
+//
+// Without Setup, the panic resumes unreported.
+func Guard() {
+	if v := recover(); v != nil {
+		defaultMu.Lock()
+		r := defaultReporter
+		defaultMu.Unlock()
+		if r == nil {
+			panic(v)
+		}
+		r.handle(v)
+	}
+}
+
+// Go runs fn in a new goroutine guarded by the Reporter of Setup.
+func Go(fn func()) {
+	go func() {
+		defer Guard()
+		fn()
+	}()
+}
+
+// Guard reports a panic. It must be deferred directly:
+//
+//	defer r.Guard()
+func (r *Reporter) Guard() {
+	if v := recover(); v != nil {
+		r.handle(v)
+	}
+}
+
+// Go runs fn in a new goroutine guarded by r.
+func (r *Reporter) Go(fn func()) {
+	go func() {
+		defer r.Guard()
+		fn()
+	}()
+}
+
+// Reports the panic v, then resumes it or exits.
+func (r *Reporter) handle(v any) {
+	stack := debug.Stack()
+	r.mu.Lock()
+	err := r.Report(v, stack)
+	r.mu.Unlock()
+	if err != nil && r.OnError != nil {
+		r.OnError(err)
+	}
+	if r.Exit {
+		fmt.Fprintf(os.Stderr, "panic: %v\n\n%s", v, stack)
+		exit(2)
+	}
+	panic(v)
+}
+
+// Report pushes the report of the panic v with the stack of the panicking
+// goroutine, within Timeout. The goroutine dump is attached if it can be
+// uploaded in half of it, the rest being kept for the report itself.
+func (r *Reporter) Report(v any, stack []byte) error {
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	hostname, _ := os.Hostname()
+	title := r.Title
+	if title == "" {
+		title = programName()
+	}
+	params := client.Params{}
+	for k, value := range r.Params {
+		params[k] = value
+	}
+	params["type"] = "note"
+	params["title"] = fmt.Sprintf("%s panicked on %s: %v", title, hostname, v)
+	if len(stack) > maxStack {
+		stack = append(stack[:maxStack:maxStack], "\n..."...)
+	}
+	params["body"] = fmt.Sprintf("panic: %v\n\nhost: %s\nversion: %s\n\n%s", v, hostname, version(), stack)
+
+	fileName := fmt.Sprintf("%s-%s-goroutines.txt", programName(), time.Now().UTC().Format("20060102T150405Z"))
+	attachCtx, cancelAttach := context.WithTimeout(ctx, timeout/2)
+	fileUrl, err := r.attach(attachCtx, fileName)
+	cancelAttach()
+	if err == nil {
+		params["type"] = "file"
+		params["file_name"] = fileName
+		params["file_type"] = "text/plain"
+		params["file_url"] = fileUrl
+	} else if r.OnError != nil {
+		r.OnError(err)
+	}
+	_, err = r.client.CreatePush(ctx, params)
+	return err
+}
+
+// Uploads the dump of every goroutine.
+func (r *Reporter) attach(ctx context.Context, fileName string) (string, error) {
+	f, err := os.CreateTemp("", "pbcrash-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(goroutines())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	return r.client.PushFile(ctx, fileName, "text/plain", f.Name())
+}
+
+// Returns the stacks of every goroutine.
+func goroutines() []byte {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= 64<<20 {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// Returns the module version and VCS revision of the binary.
+func version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown (" + runtime.Version() + ")"
+	}
+	v := info.Main.Version
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			v += " " + setting.Value
+		case "vcs.modified":
+			if setting.Value == "true" {
+				v += " (modified)"
+			}
+		}
+	}
+	return strings.TrimSpace(v) + " (" + info.GoVersion + ")"
+}
+
+func programName() string {
+	name := os.Args[0]
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
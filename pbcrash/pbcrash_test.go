@@ -0,0 +1,108 @@
+package pbcrash
+
+import (
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+	"github.com/lucasweiblen/pushbulletclient/pbtest"
+)
+
+func TestGuard(t *testing.T) {
+	server := pbtest.NewServer()
+	defer server.Close()
+	r := New(server.Client(), client.Params{"channel_tag": "crashes"})
+	r.Title = "billing"
+
+	done := make(chan any)
+	go func() {
+		// The panic resumes after the report.
+		defer func() {
+			done <- recover()
+		}()
+		defer r.Guard()
+		panic("out of cheese")
+	}()
+	if v := <-done; v != "out of cheese" {
+		t.Errorf("Expected the panic to resume, got %v", v)
+	}
+
+	pushes := server.Pushes()
+	if len(pushes) != 1 {
+		t.Fatalf("Expected a report, got %#v", pushes)
+	}
+	report := pushes[0]
+	if report.Type != "file" || !strings.HasPrefix(report.Title, "billing panicked on ") || !strings.HasSuffix(report.Title, ": out of cheese") {
+		t.Errorf("Unexpected report %#v", report)
+	}
+	if !strings.Contains(report.Body, "panic: out of cheese") || !strings.Contains(report.Body, "pbcrash.TestGuard") {
+		t.Errorf("Expected the stack in the body, got %q", report.Body)
+	}
+	dump, _ := server.File(report.FileUrl)
+	if !strings.Contains(string(dump), "goroutine ") {
+		t.Errorf("Expected the goroutine dump attached, got %q", dump)
+	}
+}
+
+func TestGuardExit(t *testing.T) {
+	server := pbtest.NewServer()
+	defer server.Close()
+	defaultMu.Lock()
+	oldReporter, oldExit := defaultReporter, exit
+	defaultMu.Unlock()
+	code := make(chan int, 1)
+	stop := make(chan struct{})
+	exit = func(c int) {
+		code <- c
+		// Stands in for the end of the program, ending the goroutine
+		// with the test.
+		<-stop
+		runtime.Goexit()
+	}
+	t.Cleanup(func() {
+		close(stop)
+		defaultMu.Lock()
+		defaultReporter, exit = oldReporter, oldExit
+		defaultMu.Unlock()
+	})
+	r := Setup(server.Client(), nil)
+	r.Exit = true
+	Go(func() {
+		panic("boom")
+	})
+	if c := <-code; c != 2 {
+		t.Errorf("Expected exit status 2, got %d", c)
+	}
+	if pushes := server.Pushes(); len(pushes) != 1 || !strings.HasSuffix(pushes[0].Title, ": boom") {
+		t.Errorf("Expected a report, got %#v", pushes)
+	}
+}
+
+// Holds uploads until they are cancelled.
+type slowUpload struct{}
+
+func (slowUpload) RoundTrip(r *http.Request) (*http.Response, error) {
+	if strings.HasPrefix(r.URL.Path, "/upload/") {
+		<-r.Context().Done()
+		return nil, r.Context().Err()
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestReportSlowUpload(t *testing.T) {
+	server := pbtest.NewServer()
+	defer server.Close()
+	cli := server.Client()
+	cli.HttpClient = &http.Client{Transport: slowUpload{}}
+	r := New(cli, nil)
+	r.Timeout = 200 * time.Millisecond
+	if err := r.Report("boom", []byte("stack")); err != nil {
+		t.Fatalf("Expected the report without the dump, got %v", err)
+	}
+	if pushes := server.Pushes(); len(pushes) != 1 || pushes[0].Type != "note" {
+		t.Errorf("Expected a note, got %#v", pushes)
+	}
+}
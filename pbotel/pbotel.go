@@ -0,0 +1,64 @@
+// Package pbotel emits OpenTelemetry spans for Pushbullet API calls.
+//
+// Usage:
+//
+//	cli := client.NewClient(token)
+//	cli.Observer = pbotel.New(nil)
+package pbotel
+
+import (
+	"context"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/lucasweiblen/pushbulletclient/pbotel"
+
+// Tracer starts a client span named after the logical operation around
+// every API call, file upload and download. It implements client.Observer.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// New creates a Tracer from provider. If provider is nil the global tracer
+// provider is used.
+func New(provider trace.TracerProvider) *Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &Tracer{tracer: provider.Tracer(instrumentationName)}
+}
+
+// Start implements client.Observer.
+func (t *Tracer) Start(ctx context.Context, operation string) (context.Context, func(client.Call)) {
+	ctx, span := t.tracer.Start(ctx, "pushbullet."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("pushbullet.operation", operation)))
+	return ctx, func(call client.Call) {
+		span.SetAttributes(
+			attribute.String("http.request.method", call.Method),
+			attribute.String("url.full", call.Endpoint),
+		)
+		if call.Status != 0 {
+			span.SetAttributes(attribute.Int("http.response.status_code", call.Status))
+		}
+		if call.RateLimitRemaining >= 0 {
+			span.SetAttributes(attribute.Int("pushbullet.ratelimit.remaining", call.RateLimitRemaining))
+		}
+		if call.BytesUploaded > 0 {
+			span.SetAttributes(attribute.Int64("pushbullet.upload.bytes", call.BytesUploaded))
+		}
+		if call.BytesDownloaded > 0 {
+			span.SetAttributes(attribute.Int64("pushbullet.download.bytes", call.BytesDownloaded))
+		}
+		if call.Err != nil {
+			span.RecordError(call.Err)
+			span.SetStatus(codes.Error, call.Err.Error())
+		}
+		span.End()
+	}
+}
@@ -0,0 +1,102 @@
+package pbotel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+	"github.com/lucasweiblen/pushbulletclient/pbtest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTracer() (*Tracer, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	return New(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))), recorder
+}
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestTracer(t *testing.T) {
+	tracer, recorder := newTracer()
+	ctx, done := tracer.Start(context.Background(), "PushFile")
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		t.Error("Expected the span in the context of the call")
+	}
+	done(client.Call{Operation: "PushFile", Method: "POST", Endpoint: "https://upload.example.com/", Status: 204, RateLimitRemaining: 4200, BytesUploaded: 1024})
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "pushbullet.PushFile" || span.SpanKind() != trace.SpanKindClient || span.Status().Code != codes.Unset {
+		t.Errorf("Unexpected span %q, kind %v, status %v", span.Name(), span.SpanKind(), span.Status())
+	}
+	attrs := attributes(span)
+	expected := map[attribute.Key]attribute.Value{
+		"pushbullet.operation":           attribute.StringValue("PushFile"),
+		"http.request.method":            attribute.StringValue("POST"),
+		"url.full":                       attribute.StringValue("https://upload.example.com/"),
+		"http.response.status_code":      attribute.IntValue(204),
+		"pushbullet.ratelimit.remaining": attribute.IntValue(4200),
+		"pushbullet.upload.bytes":        attribute.Int64Value(1024),
+	}
+	for key, value := range expected {
+		if attrs[key] != value {
+			t.Errorf("Expected %s=%v, got %v", key, value.Emit(), attrs[key].Emit())
+		}
+	}
+	if _, ok := attrs["pushbullet.download.bytes"]; ok {
+		t.Error("Expected no download size")
+	}
+}
+
+func TestTracerError(t *testing.T) {
+	tracer, recorder := newTracer()
+	_, done := tracer.Start(context.Background(), "GetDevices")
+	done(client.Call{Operation: "GetDevices", Method: "GET", Err: errors.New("connection refused"), RateLimitRemaining: -1})
+
+	span := recorder.Ended()[0]
+	if span.Status().Code != codes.Error || span.Status().Description != "connection refused" {
+		t.Errorf("Expected an error status, got %v", span.Status())
+	}
+	if events := span.Events(); len(events) != 1 || events[0].Name != "exception" {
+		t.Errorf("Expected the error recorded, got %#v", events)
+	}
+	attrs := attributes(span)
+	for _, key := range []attribute.Key{"http.response.status_code", "pushbullet.ratelimit.remaining"} {
+		if _, ok := attrs[key]; ok {
+			t.Errorf("Expected no %s", key)
+		}
+	}
+}
+
+func TestTracerClient(t *testing.T) {
+	server := pbtest.NewServer()
+	defer server.Close()
+	tracer, recorder := newTracer()
+	cli := server.Client()
+	cli.Observer = tracer
+
+	if _, err := cli.CreatePush(context.Background(), client.Params{"type": "note", "body": "foo"}); err != nil {
+		t.Fatal(err)
+	}
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Name() != "pushbullet.CreatePush" {
+		t.Fatalf("Expected a CreatePush span, got %#v", spans)
+	}
+	if status := attributes(spans[0])["http.response.status_code"]; status != attribute.IntValue(200) {
+		t.Errorf("Expected status 200, got %v", status.Emit())
+	}
+}
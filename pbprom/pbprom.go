@@ -0,0 +1,104 @@
+// Package pbprom exports Prometheus metrics for Pushbullet API calls.
+//
+// Usage:
+//
+//	metrics := pbprom.New("myapp")
+//	prometheus.MustRegister(metrics)
+//	cli := client.NewClient(token)
+//	cli.Observer = metrics
+package pbprom
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector records request counts, latencies, the remaining rate limit and
+// transferred file bytes labelled by the logical operation. It implements
+// both client.Observer and prometheus.Collector.
+type Collector struct {
+	requests   *prometheus.CounterVec
+	latency    *prometheus.HistogramVec
+	rateLimit  prometheus.Gauge
+	uploaded   *prometheus.CounterVec
+	downloaded *prometheus.CounterVec
+}
+
+// New creates a Collector whose metrics are prefixed with namespace.
+func New(namespace string) *Collector {
+	return &Collector{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "pushbullet",
+			Name:      "requests_total",
+			Help:      "Pushbullet API calls by operation and result code.",
+		}, []string{"operation", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "pushbullet",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of Pushbullet API calls by operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		rateLimit: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "pushbullet",
+			Name:      "ratelimit_remaining",
+			Help:      "Last reported value of X-Ratelimit-Remaining.",
+		}),
+		uploaded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "pushbullet",
+			Name:      "upload_bytes_total",
+			Help:      "Bytes uploaded by file pushes.",
+		}, []string{"operation"}),
+		downloaded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "pushbullet",
+			Name:      "download_bytes_total",
+			Help:      "Bytes downloaded from file pushes.",
+		}, []string{"operation"}),
+	}
+}
+
+// Start implements client.Observer.
+func (c *Collector) Start(ctx context.Context, operation string) (context.Context, func(client.Call)) {
+	return ctx, func(call client.Call) {
+		code := "error"
+		if call.Status != 0 {
+			code = strconv.Itoa(call.Status)
+		}
+		c.requests.WithLabelValues(call.Operation, code).Inc()
+		c.latency.WithLabelValues(call.Operation).Observe(call.Duration.Seconds())
+		if call.RateLimitRemaining >= 0 {
+			c.rateLimit.Set(float64(call.RateLimitRemaining))
+		}
+		if call.BytesUploaded > 0 {
+			c.uploaded.WithLabelValues(call.Operation).Add(float64(call.BytesUploaded))
+		}
+		if call.BytesDownloaded > 0 {
+			c.downloaded.WithLabelValues(call.Operation).Add(float64(call.BytesDownloaded))
+		}
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.requests.Describe(ch)
+	c.latency.Describe(ch)
+	c.rateLimit.Describe(ch)
+	c.uploaded.Describe(ch)
+	c.downloaded.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.requests.Collect(ch)
+	c.latency.Collect(ch)
+	c.rateLimit.Collect(ch)
+	c.uploaded.Collect(ch)
+	c.downloaded.Collect(ch)
+}
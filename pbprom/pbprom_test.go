@@ -0,0 +1,78 @@
+package pbprom
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+	"github.com/lucasweiblen/pushbulletclient/pbtest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	metrics := New("test")
+	ctx := context.Background()
+	_, done := metrics.Start(ctx, "PushFile")
+	done(client.Call{Operation: "PushFile", Status: 204, Duration: 250 * time.Millisecond, RateLimitRemaining: 4200, BytesUploaded: 1024})
+	_, done = metrics.Start(ctx, "DownloadFile")
+	done(client.Call{Operation: "DownloadFile", Status: 200, Duration: time.Second, RateLimitRemaining: -1, BytesDownloaded: 2048})
+	_, done = metrics.Start(ctx, "GetDevices")
+	done(client.Call{Operation: "GetDevices", Err: errors.New("connection refused"), RateLimitRemaining: -1})
+
+	expected := `
+# HELP test_pushbullet_download_bytes_total Bytes downloaded from file pushes.
+# TYPE test_pushbullet_download_bytes_total counter
+test_pushbullet_download_bytes_total{operation="DownloadFile"} 2048
+# HELP test_pushbullet_ratelimit_remaining Last reported value of X-Ratelimit-Remaining.
+# TYPE test_pushbullet_ratelimit_remaining gauge
+test_pushbullet_ratelimit_remaining 4200
+# HELP test_pushbullet_requests_total Pushbullet API calls by operation and result code.
+# TYPE test_pushbullet_requests_total counter
+test_pushbullet_requests_total{code="200",operation="DownloadFile"} 1
+test_pushbullet_requests_total{code="204",operation="PushFile"} 1
+test_pushbullet_requests_total{code="error",operation="GetDevices"} 1
+# HELP test_pushbullet_upload_bytes_total Bytes uploaded by file pushes.
+# TYPE test_pushbullet_upload_bytes_total counter
+test_pushbullet_upload_bytes_total{operation="PushFile"} 1024
+`
+	err := testutil.CollectAndCompare(metrics, strings.NewReader(expected),
+		"test_pushbullet_download_bytes_total", "test_pushbullet_ratelimit_remaining",
+		"test_pushbullet_requests_total", "test_pushbullet_upload_bytes_total")
+	if err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(metrics, "test_pushbullet_request_duration_seconds"); n != 3 {
+		t.Errorf("Expected a latency histogram per operation, got %d", n)
+	}
+}
+
+func TestCollectorClient(t *testing.T) {
+	server := pbtest.NewServer()
+	defer server.Close()
+	metrics := New("test")
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(metrics)
+	cli := server.Client()
+	cli.Observer = metrics
+
+	ctx := context.Background()
+	if _, err := cli.CreatePush(ctx, client.Params{"type": "note", "body": "foo"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.GetDevices(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v := testutil.ToFloat64(metrics.requests.WithLabelValues("CreatePush", "200")); v != 1 {
+		t.Errorf("Expected 1 CreatePush call, got %v", v)
+	}
+	if v := testutil.ToFloat64(metrics.requests.WithLabelValues("GetDevices", "200")); v != 1 {
+		t.Errorf("Expected 1 GetDevices call, got %v", v)
+	}
+	if _, err := registry.Gather(); err != nil {
+		t.Errorf("Expected consistent metrics, got %v", err)
+	}
+}
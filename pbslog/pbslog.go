@@ -0,0 +1,348 @@
+// Package pbslog forwards high-severity log records as Pushbullet notes.
+//
+// Handler wraps another slog.Handler: every record still goes to it, and
+// records at or above a level are also queued and pushed in the
+// background, so logging never waits on the API. Repeated messages are
+// pushed once per window, and during storms records are gathered into
+// digests to stay within a rate limit.
+//
+// Usage:
+//
+//	handler := pbslog.New(slog.NewTextHandler(os.Stderr, nil), cli, pbslog.Options{
+//		Title:  "billing",
+//		Params: client.Params{"email": "oncall@example.com"},
+//	})
+//	defer handler.Close(context.Background())
+//	slog.SetDefault(slog.New(handler))
+//
+// The client of the handler must not log to it: its own failures would be
+// pushed in turn.
+package pbslog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+// Defaults of Options.
+const (
+	DefaultLevel     = slog.LevelError
+	DefaultInterval  = time.Minute
+	DefaultBurst     = 3
+	DefaultWindow    = 10 * time.Minute
+	DefaultQueueSize = 256
+)
+
+// Records listed in a digest; the rest are counted.
+const maxDigest = 50
+
+// Timeout of a push.
+var pushTimeout = 30 * time.Second
+
+// Options configure a Handler. Zero values use the defaults.
+type Options struct {
+	// Level from which records are pushed.
+	Level slog.Leveler
+	// Params are added to every push, typically the target: device_iden,
+	// email or channel_tag.
+	Params client.Params
+	// Title prefixes the title of the pushes, e.g. the service name.
+	Title string
+	// Burst pushes may be sent back to back, then one per Interval.
+	// Records waiting for their turn are pushed together as a digest.
+	Interval time.Duration
+	Burst    int
+	// Window during which a message identical to a pushed one, same level
+	// and text, is only counted.
+	Window time.Duration
+	// QueueSize bounds the records waiting to be pushed. Records arriving
+	// when the queue is full are dropped and counted.
+	QueueSize int
+	// OnError, if set, is called when a push fails.
+	OnError func(error)
+}
+
+// A record to push.
+type entry struct {
+	time    time.Time
+	level   slog.Level
+	message string
+	// Record formatted with its attributes.
+	text string
+	// Identical records not pushed before this one.
+	repeated int
+}
+
+// Handler is a slog.Handler pushing records at or above a level.
+type Handler struct {
+	next slog.Handler
+	// Applies the attributes and groups of the handler to the handler
+	// formatting pushed records.
+	with []func(slog.Handler) slog.Handler
+	*sender
+}
+
+// New returns a Handler forwarding every record to next and pushing those
+// at or above opts.Level with c. The handler delivers from a goroutine
+// until Close.
+func New(next slog.Handler, c *client.Client, opts Options) *Handler {
+	if opts.Level == nil {
+		opts.Level = DefaultLevel
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = DefaultBurst
+	}
+	if opts.Window <= 0 {
+		opts.Window = DefaultWindow
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	s := &sender{
+		opts:       opts,
+		client:     c,
+		queue:      make(chan entry, opts.QueueSize),
+		done:       make(chan struct{}),
+		tokens:     float64(opts.Burst),
+		refilled:   time.Now(),
+		seen:       map[string]time.Time{},
+		suppressed: map[string]int{},
+	}
+	go s.run()
+	return &Handler{next: next, sender: s}
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.opts.Level.Level() || h.next.Enabled(ctx, level)
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	var err error
+	if h.next.Enabled(ctx, r.Level) {
+		err = h.next.Handle(ctx, r)
+	}
+	if r.Level >= h.opts.Level.Level() {
+		if r.Time.IsZero() {
+			r.Time = time.Now()
+		}
+		h.enqueue(entry{time: r.Time, level: r.Level, message: r.Message, text: h.format(ctx, r)})
+	}
+	return err
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.derive(h.next.WithAttrs(attrs), func(next slog.Handler) slog.Handler {
+		return next.WithAttrs(attrs)
+	})
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return h.derive(h.next.WithGroup(name), func(next slog.Handler) slog.Handler {
+		return next.WithGroup(name)
+	})
+}
+
+// Returns a handler sharing the queue of h.
+func (h *Handler) derive(next slog.Handler, with func(slog.Handler) slog.Handler) *Handler {
+	return &Handler{next: next, with: append(h.with[:len(h.with):len(h.with)], with), sender: h.sender}
+}
+
+// Formats r as a line of text, without time and level.
+func (h *Handler) format(ctx context.Context, r slog.Record) string {
+	var buf bytes.Buffer
+	var text slog.Handler = slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug - 100,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	for _, with := range h.with {
+		text = with(text)
+	}
+	text.Handle(ctx, r)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// Queue and delivery shared by a Handler and the handlers derived from it.
+type sender struct {
+	opts   Options
+	client *client.Client
+	queue  chan entry
+	done   chan struct{}
+
+	mu      sync.Mutex
+	closed  bool
+	dropped int
+
+	// Only used by the delivery goroutine.
+	tokens     float64
+	refilled   time.Time
+	pending    []entry
+	seen       map[string]time.Time
+	suppressed map[string]int
+}
+
+// Queues e without blocking.
+func (s *sender) enqueue(e entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- e:
+	default:
+		s.dropped++
+	}
+}
+
+// Close stops accepting records and waits until the queued ones are pushed,
+// ignoring the rate limit, or ctx is done. It closes the handlers derived
+// from h too.
+func (h *Handler) Close(ctx context.Context) error {
+	return h.sender.close(ctx)
+}
+
+func (s *sender) close(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *sender) run() {
+	defer close(s.done)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case e, ok := <-s.queue:
+			if !ok {
+				s.flush()
+				return
+			}
+			s.add(e)
+		case <-timer.C:
+		}
+		if wait := s.deliver(); wait > 0 {
+			timer.Reset(wait)
+		}
+	}
+}
+
+// Adds e to the pending records, unless an identical one was pushed within
+// the window.
+func (s *sender) add(e entry) {
+	key := e.level.String() + " " + e.message
+	for k, t := range s.seen {
+		if e.time.Sub(t) >= s.opts.Window {
+			delete(s.seen, k)
+		}
+	}
+	if _, ok := s.seen[key]; ok {
+		s.suppressed[key]++
+		return
+	}
+	s.seen[key] = e.time
+	e.repeated = s.suppressed[key]
+	delete(s.suppressed, key)
+	s.pending = append(s.pending, e)
+}
+
+// Pushes the pending records if the rate limit allows, and returns how long
+// to wait otherwise, 0 if nothing is pending.
+func (s *sender) deliver() time.Duration {
+	if len(s.pending) == 0 {
+		return 0
+	}
+	now := time.Now()
+	s.tokens = min(float64(s.opts.Burst), s.tokens+float64(now.Sub(s.refilled))/float64(s.opts.Interval))
+	s.refilled = now
+	if s.tokens < 1 {
+		return time.Duration((1 - s.tokens) * float64(s.opts.Interval))
+	}
+	s.tokens--
+	s.push()
+	return 0
+}
+
+// Pushes the pending records regardless of the rate limit.
+func (s *sender) flush() {
+	if len(s.pending) > 0 {
+		s.push()
+	}
+}
+
+// Pushes the pending records, as a single note or a digest.
+func (s *sender) push() {
+	pending := s.pending
+	s.pending = nil
+	s.mu.Lock()
+	dropped := s.dropped
+	s.dropped = 0
+	s.mu.Unlock()
+
+	var title string
+	var body strings.Builder
+	if len(pending) == 1 {
+		e := pending[0]
+		title = e.level.String() + ": " + e.message
+		fmt.Fprintf(&body, "%s\n%s", e.time.Format(time.RFC3339), e.text)
+		if e.repeated > 0 {
+			fmt.Fprintf(&body, "\n(repeated %d times since last pushed)", e.repeated)
+		}
+	} else {
+		title = fmt.Sprintf("%d log records", len(pending))
+		for i, e := range pending {
+			if i == maxDigest {
+				fmt.Fprintf(&body, "... and %d more\n", len(pending)-maxDigest)
+				break
+			}
+			fmt.Fprintf(&body, "%s %s %s", e.time.Format(time.TimeOnly), e.level, e.text)
+			if e.repeated > 0 {
+				fmt.Fprintf(&body, " (repeated %d times)", e.repeated)
+			}
+			body.WriteString("\n")
+		}
+	}
+	if dropped > 0 {
+		fmt.Fprintf(&body, "\n(%d records dropped, queue full)", dropped)
+	}
+	if s.opts.Title != "" {
+		title = s.opts.Title + ": " + title
+	}
+
+	params := client.Params{}
+	for k, v := range s.opts.Params {
+		params[k] = v
+	}
+	params["type"] = "note"
+	params["title"] = title
+	params["body"] = strings.TrimSuffix(body.String(), "\n")
+	ctx, cancel := context.WithTimeout(context.Background(), pushTimeout)
+	defer cancel()
+	if _, err := s.client.CreatePush(ctx, params); err != nil && s.opts.OnError != nil {
+		s.opts.OnError(err)
+	}
+}
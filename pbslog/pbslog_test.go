@@ -0,0 +1,103 @@
+package pbslog
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+	"github.com/lucasweiblen/pushbulletclient/pbtest"
+)
+
+func TestHandler(t *testing.T) {
+	server := pbtest.NewServer()
+	defer server.Close()
+	var local bytes.Buffer
+	handler := New(slog.NewTextHandler(&local, nil), server.Client(), Options{
+		Title:    "billing",
+		Params:   client.Params{"email": "oncall@example.com"},
+		Interval: time.Hour,
+		Burst:    1,
+	})
+	logger := slog.New(handler).With("service", "api")
+
+	logger.Info("started")
+	logger.Error("payment failed", "order", 42)
+	logger.Error("payment failed", "order", 43)
+	logger.Error("database down")
+	logger.Warn("slow query")
+	if err := handler.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Count(local.String(), "\n"); lines != 5 {
+		t.Errorf("Expected every record to reach the next handler, got %d lines:\n%s", lines, local.String())
+	}
+	pushes := server.Pushes()
+	if len(pushes) != 2 {
+		t.Fatalf("Expected a push and a digest, got %#v", pushes)
+	}
+	first := pushes[0]
+	if first.Title != "billing: ERROR: payment failed" || !strings.Contains(first.Body, `msg="payment failed" service=api order=42`) ||
+		first.ReceiverEmail != "oncall@example.com" {
+		t.Errorf("Unexpected push %#v", first)
+	}
+	// The duplicate is only counted, and the next record waits for the
+	// rate limit until Close flushes it.
+	if last := pushes[1]; last.Title != "billing: ERROR: database down" || strings.Contains(last.Body, "order=43") {
+		t.Errorf("Unexpected push %#v", last)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	server := pbtest.NewServer()
+	defer server.Close()
+	handler := New(slog.DiscardHandler, server.Client(), Options{Interval: 100 * time.Millisecond, Burst: 1, Window: time.Millisecond})
+	logger := slog.New(handler)
+	logger.Error("first")
+	// A storm while the rate limit holds is pushed as one digest.
+	for i := 0; i < 5; i++ {
+		logger.Error("storm", "i", i)
+		logger.Error("other", "i", i)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(server.Pushes()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	handler.Close(context.Background())
+	pushes := server.Pushes()
+	if len(pushes) < 2 || pushes[0].Title != "ERROR: first" {
+		t.Fatalf("Expected a push then a digest, got %#v", pushes)
+	}
+	if !strings.HasSuffix(pushes[1].Title, "log records") || !strings.Contains(pushes[1].Body, "ERROR msg=storm") {
+		t.Errorf("Unexpected digest %#v", pushes[1])
+	}
+}
+
+func TestDedup(t *testing.T) {
+	s := &sender{opts: Options{Window: time.Minute}, seen: map[string]time.Time{}, suppressed: map[string]int{}}
+	now := time.Now()
+	s.add(entry{time: now, level: slog.LevelError, message: "disk full"})
+	s.add(entry{time: now.Add(time.Second), level: slog.LevelError, message: "disk full"})
+	s.add(entry{time: now.Add(time.Second), level: slog.LevelWarn, message: "disk full"})
+	s.add(entry{time: now.Add(2 * time.Second), level: slog.LevelError, message: "disk full"})
+	s.add(entry{time: now.Add(2 * time.Minute), level: slog.LevelError, message: "disk full"})
+	if len(s.pending) != 3 {
+		t.Fatalf("Expected 3 pending records, got %#v", s.pending)
+	}
+	if last := s.pending[2]; last.repeated != 2 {
+		t.Errorf("Expected the duplicates to be counted, got %d", last.repeated)
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	s := &sender{queue: make(chan entry, 1)}
+	s.enqueue(entry{message: "a"})
+	s.enqueue(entry{message: "b"})
+	if s.dropped != 1 {
+		t.Errorf("Expected a dropped record, got %d", s.dropped)
+	}
+}
@@ -0,0 +1,523 @@
+// Package pbtest provides a fake Pushbullet server for tests of programs
+// built on the client.
+//
+// The server keeps devices, pushes, chats, subscriptions and uploaded files
+// in memory, delivers ephemerals and tickles on its realtime event stream,
+// and accepts a single access token.
+//
+// Usage:
+//
+//	server := pbtest.NewServer()
+//	defer server.Close()
+//	cli := server.Client()
+//	push, err := cli.CreatePush(ctx, client.Params{"type": "note", "body": "foo"})
+package pbtest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+// Token is the access token accepted by a Server.
+const Token = "pbtest-token"
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Server is a fake Pushbullet API and realtime event stream.
+type Server struct {
+	// URL of the API, for Client.BaseURL.
+	URL string
+	// URL of the stream, for Client.StreamURL.
+	StreamURL string
+	// User returned by users/me.
+	User client.User
+
+	server   *httptest.Server
+	mu       sync.Mutex
+	devices  []client.Device
+	pushes   []client.Push
+	chats    []client.Chat
+	subs     []client.Subscription
+	modified float64
+	// Open streams, by their queue of messages.
+	streams map[chan []byte]net.Conn
+	// Uploaded files by path of their file_url.
+	files map[string][]byte
+	next  int
+}
+
+// NewServer starts a Server. It must be closed once the test is done.
+func NewServer() *Server {
+	s := &Server{
+		User:    client.User{Iden: "user", Email: "user@example.com", EmailNormalized: "user@example.com", Name: "User"},
+		streams: map[chan []byte]net.Conn{},
+		files:   map[string][]byte{},
+	}
+	s.server = httptest.NewServer(s)
+	s.URL = s.server.URL + "/v2/"
+	s.StreamURL = "ws" + strings.TrimPrefix(s.server.URL, "http") + "/websocket/"
+	return s
+}
+
+// Close shuts the server down, closing open streams.
+func (s *Server) Close() {
+	s.mu.Lock()
+	for _, conn := range s.streams {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.server.Close()
+}
+
+// Client returns a client of the server.
+func (s *Server) Client() *client.Client {
+	cli := client.NewClient(Token)
+	cli.BaseURL = s.URL
+	cli.StreamURL = s.StreamURL
+	return cli
+}
+
+// Devices returns the devices of the account, deleted ones included.
+func (s *Server) Devices() []client.Device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]client.Device(nil), s.devices...)
+}
+
+// Pushes returns the pushes of the account, oldest first, deleted ones
+// included.
+func (s *Server) Pushes() []client.Push {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]client.Push(nil), s.pushes...)
+}
+
+// Chats returns the chats of the account, oldest first.
+func (s *Server) Chats() []client.Chat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]client.Chat(nil), s.chats...)
+}
+
+// Subscriptions returns the channel subscriptions of the account, oldest
+// first.
+func (s *Server) Subscriptions() []client.Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]client.Subscription(nil), s.subs...)
+}
+
+// File returns the content of the file uploaded to fileUrl.
+func (s *Server) File(fileUrl string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[strings.TrimPrefix(fileUrl, s.server.URL)]
+	return data, ok
+}
+
+// AddDevice adds a device to the account and tickles the stream. A missing
+// iden is generated.
+func (s *Server) AddDevice(device client.Device) client.Device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if device.Iden == "" {
+		device.Iden = s.iden("device")
+	}
+	s.devices = append(s.devices, device)
+	s.broadcast(map[string]any{"type": "tickle", "subtype": "device"})
+	return device
+}
+
+// AddPush adds a push to the account, as if sent by another device, and
+// tickles the stream. A missing iden and the timestamps are generated.
+func (s *Server) AddPush(push client.Push) client.Push {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if push.Iden == "" {
+		push.Iden = s.iden("push")
+	}
+	push.Created = s.now()
+	push.Modified = push.Created
+	s.pushes = append(s.pushes, push)
+	s.broadcast(map[string]any{"type": "tickle", "subtype": "push"})
+	return push
+}
+
+// AddChat adds a chat with email to the account.
+func (s *Server) AddChat(email string) client.Chat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addChat(email)
+}
+
+// AddSubscription subscribes the account to the channel with tag.
+func (s *Server) AddSubscription(tag string) client.Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscribe(tag)
+}
+
+// AddFile stores a file as if uploaded, and returns its file_url.
+func (s *Server) AddFile(name string, data []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := "/files/" + s.iden("file") + "/" + name
+	s.files[path] = data
+	return s.server.URL + path
+}
+
+// Send delivers msg, such as a tickle or an ephemeral, on every open stream.
+func (s *Server) Send(msg client.StreamMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.broadcast(msg)
+}
+
+// WaitStreams waits until at least n streams are open, and reports whether
+// they were before timeout.
+func (s *Server) WaitStreams(n int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		s.mu.Lock()
+		open := len(s.streams)
+		s.mu.Unlock()
+		if open >= n {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/websocket/") {
+		if strings.TrimPrefix(r.URL.Path, "/websocket/") != Token {
+			unauthorized(w)
+			return
+		}
+		s.stream(w, r)
+		return
+	}
+	// Uploads and files are served by the file storage, without token.
+	if strings.HasPrefix(r.URL.Path, "/upload/") || strings.HasPrefix(r.URL.Path, "/files/") {
+		s.file(w, r)
+		return
+	}
+	if token, _, _ := r.BasicAuth(); token != Token {
+		unauthorized(w)
+		return
+	}
+	var params client.Params
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&params)
+	}
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v2/"), "/"), "/")
+	iden := ""
+	if len(path) > 1 {
+		iden = path[1]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case path[0] == "users" && r.Method == "GET":
+		writeJSON(w, s.User)
+	case path[0] == "devices" && r.Method == "GET":
+		var devices []client.Device
+		for _, device := range s.devices {
+			if device.Active {
+				devices = append(devices, device)
+			}
+		}
+		writeJSON(w, client.Devices{Devices: devices})
+	case path[0] == "devices" && iden == "" && r.Method == "POST":
+		device := client.Device{Iden: s.iden("device"), Active: true, Pushable: true}
+		setDevice(&device, params)
+		device.Type = str(params["type"])
+		s.devices = append(s.devices, device)
+		s.broadcast(map[string]any{"type": "tickle", "subtype": "device"})
+		writeJSON(w, device)
+	case path[0] == "devices":
+		i := s.device(iden)
+		if i < 0 {
+			notFound(w)
+			return
+		}
+		if r.Method == "DELETE" {
+			s.devices[i].Active = false
+		} else {
+			setDevice(&s.devices[i], params)
+		}
+		s.broadcast(map[string]any{"type": "tickle", "subtype": "device"})
+		writeJSON(w, s.devices[i])
+	case path[0] == "pushes" && r.Method == "GET":
+		after, _ := strconv.ParseFloat(r.URL.Query().Get("modified_after"), 64)
+		active := r.URL.Query().Get("active") == "true"
+		var pushes []client.Push
+		// Newest first, as the API.
+		for i := len(s.pushes) - 1; i >= 0; i-- {
+			push := s.pushes[i]
+			if push.Modified > after && (push.Active || !active) {
+				pushes = append(pushes, push)
+			}
+		}
+		writeJSON(w, client.Pushes{Pushes: pushes})
+	case path[0] == "pushes" && iden == "" && r.Method == "POST":
+		push := client.Push{
+			Iden: s.iden("push"), Active: true, Type: str(params["type"]), Guid: str(params["guid"]),
+			Title: str(params["title"]), Body: str(params["body"]), Url: str(params["url"]),
+			FileName: str(params["file_name"]), FileType: str(params["file_type"]), FileUrl: str(params["file_url"]),
+			SenderIden: s.User.Iden, SenderEmail: s.User.Email, SenderEmailNormalized: s.User.EmailNormalized,
+			SenderName: s.User.Name, ReceiverEmail: str(params["email"]),
+			TargetDeviceIden: str(params["device_iden"]), SourceDeviceIden: str(params["source_device_iden"]),
+		}
+		push.Created = s.now()
+		push.Modified = push.Created
+		s.pushes = append(s.pushes, push)
+		s.broadcast(map[string]any{"type": "tickle", "subtype": "push"})
+		writeJSON(w, push)
+	case path[0] == "pushes" && iden == "" && r.Method == "DELETE":
+		for i := range s.pushes {
+			s.pushes[i].Active = false
+			s.pushes[i].Modified = s.now()
+		}
+		s.broadcast(map[string]any{"type": "tickle", "subtype": "push"})
+		writeJSON(w, struct{}{})
+	case path[0] == "pushes":
+		i := s.push(iden)
+		if i < 0 {
+			notFound(w)
+			return
+		}
+		if r.Method == "DELETE" {
+			s.pushes[i].Active = false
+		}
+		if dismissed, ok := params["dismissed"].(bool); ok {
+			s.pushes[i].Dismissed = dismissed
+		}
+		if title, ok := params["title"].(string); ok {
+			s.pushes[i].Title = title
+		}
+		s.pushes[i].Modified = s.now()
+		s.broadcast(map[string]any{"type": "tickle", "subtype": "push"})
+		writeJSON(w, s.pushes[i])
+	case path[0] == "chats" && r.Method == "GET":
+		writeJSON(w, client.Chats{Chats: s.chats})
+	case path[0] == "chats" && iden == "" && r.Method == "POST":
+		writeJSON(w, s.addChat(str(params["email"])))
+	case path[0] == "subscriptions" && r.Method == "GET":
+		writeJSON(w, client.Subscriptions{Subscriptions: s.subs})
+	case path[0] == "subscriptions" && iden == "" && r.Method == "POST":
+		writeJSON(w, s.subscribe(str(params["channel_tag"])))
+	case path[0] == "upload-request" && r.Method == "POST":
+		name := str(params["file_name"])
+		key := s.iden("file") + "/" + name
+		writeJSON(w, client.UploadRequest{
+			FileName: name, FileType: str(params["file_type"]),
+			FileUrl: s.server.URL + "/files/" + key, UploadUrl: s.server.URL + "/upload/" + key,
+		})
+	case path[0] == "ephemerals" && r.Method == "POST":
+		s.broadcast(params)
+		writeJSON(w, struct{}{})
+	default:
+		notFound(w)
+	}
+}
+
+// Stores an upload, or serves an uploaded file.
+func (s *Server) file(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.files["/files/"+strings.TrimPrefix(r.URL.Path, "/upload/")] = data
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	s.mu.Lock()
+	data, ok := s.files[r.URL.Path]
+	s.mu.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+// Serves a stream connection until the client or the server closes it.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request) {
+	conn, brw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + wsGUID))
+	brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	brw.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := brw.Flush(); err != nil {
+		return
+	}
+
+	messages := make(chan []byte, 64)
+	s.mu.Lock()
+	s.streams[messages] = conn
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.streams, messages)
+		s.mu.Unlock()
+	}()
+	// The client only sends pongs and close frames; the connection is done
+	// once reading fails.
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, bufio.NewReader(conn))
+		close(closed)
+	}()
+	for {
+		select {
+		case msg := <-messages:
+			frame := []byte{0x81}
+			switch {
+			case len(msg) < 126:
+				frame = append(frame, byte(len(msg)))
+			case len(msg) <= 0xffff:
+				frame = binary.BigEndian.AppendUint16(append(frame, 126), uint16(len(msg)))
+			default:
+				frame = binary.BigEndian.AppendUint64(append(frame, 127), uint64(len(msg)))
+			}
+			if _, err := conn.Write(append(frame, msg...)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// Delivers msg to every open stream. Must be called with s.mu held.
+func (s *Server) broadcast(msg any) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	for stream := range s.streams {
+		select {
+		case stream <- data:
+		default:
+		}
+	}
+}
+
+// Returns a new iden. Must be called with s.mu held.
+func (s *Server) iden(prefix string) string {
+	s.next++
+	return prefix + strconv.Itoa(s.next)
+}
+
+// Returns a modification time later than any before. Must be called with
+// s.mu held.
+func (s *Server) now() float64 {
+	now := client.Timestamp(time.Now())
+	if now <= s.modified {
+		now = s.modified + 0.001
+	}
+	s.modified = now
+	return now
+}
+
+// Must be called with s.mu held.
+func (s *Server) addChat(email string) client.Chat {
+	chat := client.Chat{Iden: s.iden("chat"), Active: true}
+	chat.Created = s.now()
+	chat.Modified = chat.Created
+	chat.With.Type = "email"
+	chat.With.Email = email
+	chat.With.EmailNormalized = strings.ToLower(email)
+	s.chats = append(s.chats, chat)
+	return chat
+}
+
+// Must be called with s.mu held.
+func (s *Server) subscribe(tag string) client.Subscription {
+	sub := client.Subscription{Iden: s.iden("subscription"), Active: true, Channel: client.Channel{Tag: tag, Name: tag}}
+	s.subs = append(s.subs, sub)
+	return sub
+}
+
+func (s *Server) device(iden string) int {
+	for i, device := range s.devices {
+		if device.Iden == iden {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Server) push(iden string) int {
+	for i, push := range s.pushes {
+		if push.Iden == iden {
+			return i
+		}
+	}
+	return -1
+}
+
+func setDevice(device *client.Device, params client.Params) {
+	if nickname, ok := params["nickname"].(string); ok {
+		device.Nickname = nickname
+	}
+	if icon, ok := params["icon"].(string); ok {
+		device.Icon = icon
+	}
+	if model, ok := params["model"].(string); ok {
+		device.Model = model
+	}
+}
+
+func str(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusUnauthorized)
+	fmt.Fprint(w, `{"error": {"type": "invalid_request", "message": "Invalid access token"}}`)
+}
+
+func notFound(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNotFound)
+	fmt.Fprint(w, `{"error": {"type": "invalid_request", "message": "Object not found"}}`)
+}
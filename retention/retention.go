@@ -0,0 +1,191 @@
+// Package retention deletes pushes according to declarative rules.
+//
+// Usage:
+//
+//	r := retention.New(cli,
+//		// Delete dismissed link pushes older than 30 days.
+//		retention.Rule{Name: "old links", Type: "link", Dismissed: true, OlderThan: 30 * 24 * time.Hour},
+//		// Keep the last 500 file pushes per device.
+//		retention.Rule{Name: "files", Type: "file", KeepLast: 500, PerDevice: true},
+//	)
+//	report, err := r.Plan(ctx)  // dry run
+//	report, err = r.Apply(ctx)
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+// Rule selects pushes to delete. The filters Type, Device and Dismissed
+// narrow the pushes the rule applies to. Of those, the rule deletes the ones
+// older than OlderThan, beyond the newest KeepLast, or, when both are set,
+// the ones that are both.
+type Rule struct {
+	Name string
+	// Push type, any if empty.
+	Type string
+	// Iden of the target or source device, any if empty.
+	Device string
+	// Dismissed only applies the rule to dismissed pushes.
+	Dismissed bool
+	OlderThan time.Duration
+	KeepLast  int
+	// PerDevice applies KeepLast to the pushes of each target device
+	// separately.
+	PerDevice bool
+}
+
+// Deletion is a push selected by a rule.
+type Deletion struct {
+	Push client.Push
+	Rule string
+	// Deleted is set once the push has been deleted, Err if that failed.
+	Deleted bool
+	Err     error
+}
+
+// Report lists the pushes selected for deletion.
+type Report struct {
+	Scanned   int
+	Deletions []Deletion
+}
+
+// Deleted returns the number of pushes deleted.
+func (r Report) Deleted() int {
+	n := 0
+	for _, d := range r.Deletions {
+		if d.Deleted {
+			n++
+		}
+	}
+	return n
+}
+
+// ByRule returns the number of pushes selected by each rule.
+func (r Report) ByRule() map[string]int {
+	counts := map[string]int{}
+	for _, d := range r.Deletions {
+		counts[d.Rule]++
+	}
+	return counts
+}
+
+// Err joins the errors of failed deletions.
+func (r Report) Err() error {
+	var errs []error
+	for _, d := range r.Deletions {
+		if d.Err != nil {
+			errs = append(errs, fmt.Errorf("push %s: %w", d.Push.Iden, d.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Retention applies rules to the pushes of an account.
+type Retention struct {
+	Rules []Rule
+	// MinRemaining pauses deletion until the rate limit resets whenever
+	// fewer requests than this are left.
+	MinRemaining int
+
+	client *client.Client
+	now    func() time.Time
+}
+
+// New creates a Retention for the account of c.
+func New(c *client.Client, rules ...Rule) *Retention {
+	return &Retention{Rules: rules, MinRemaining: 50, client: c, now: time.Now}
+}
+
+// Plan reports the pushes the rules would delete, without deleting them.
+func (r *Retention) Plan(ctx context.Context) (Report, error) {
+	pushes, err := r.client.GetPushes(ctx, client.Params{"active": true})
+	if err != nil {
+		return Report{}, err
+	}
+	report := Report{Scanned: len(pushes)}
+	selected := map[string]bool{}
+	for _, rule := range r.Rules {
+		for _, push := range rule.selectPushes(pushes, r.now()) {
+			if !selected[push.Iden] {
+				selected[push.Iden] = true
+				report.Deletions = append(report.Deletions, Deletion{Push: push, Rule: rule.Name})
+			}
+		}
+	}
+	return report, nil
+}
+
+// Apply deletes the pushes selected by the rules. Failed deletions are
+// recorded in the report; Apply only returns an error if the pushes could
+// not be listed or ctx is done.
+func (r *Retention) Apply(ctx context.Context) (Report, error) {
+	report, err := r.Plan(ctx)
+	if err != nil {
+		return report, err
+	}
+	for i := range report.Deletions {
+		if err := r.client.WaitRateLimit(ctx, r.MinRemaining); err != nil {
+			return report, err
+		}
+		d := &report.Deletions[i]
+		d.Err = r.client.DeletePush(ctx, client.Params{"iden": d.Push.Iden})
+		d.Deleted = d.Err == nil
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+	}
+	return report, nil
+}
+
+func (rule Rule) selectPushes(pushes []client.Push, now time.Time) []client.Push {
+	groups := map[string][]client.Push{}
+	for _, push := range pushes {
+		if rule.applies(push) {
+			key := ""
+			if rule.PerDevice {
+				key = push.TargetDeviceIden
+			}
+			groups[key] = append(groups[key], push)
+		}
+	}
+	var selected []client.Push
+	cutoff := now.Add(-rule.OlderThan)
+	for _, group := range groups {
+		sort.Slice(group, func(i, j int) bool {
+			return group[i].Created > group[j].Created
+		})
+		for i, push := range group {
+			old := rule.OlderThan > 0 && client.Time(push.Created).Before(cutoff)
+			excess := rule.KeepLast > 0 && i >= rule.KeepLast
+			switch {
+			case rule.OlderThan > 0 && rule.KeepLast > 0:
+				if old && excess {
+					selected = append(selected, push)
+				}
+			case old || excess:
+				selected = append(selected, push)
+			}
+		}
+	}
+	return selected
+}
+
+func (rule Rule) applies(push client.Push) bool {
+	if rule.Type != "" && push.Type != rule.Type {
+		return false
+	}
+	if rule.Device != "" && push.TargetDeviceIden != rule.Device && push.SourceDeviceIden != rule.Device {
+		return false
+	}
+	if rule.Dismissed && !push.Dismissed {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,149 @@
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+var now = time.Unix(1500000000, 0)
+
+const day = 24 * 60 * 60
+
+type fakeAPI struct {
+	mu      sync.Mutex
+	pushes  []client.Push
+	deleted []string
+	headers map[string]string
+}
+
+func (api *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	for k, v := range api.headers {
+		w.Header().Set(k, v)
+	}
+	if r.Method == "GET" {
+		json.NewEncoder(w).Encode(client.Pushes{Pushes: api.pushes})
+		return
+	}
+	iden := strings.TrimPrefix(r.URL.Path, "/v2/pushes/")
+	if iden == "fail" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	api.deleted = append(api.deleted, iden)
+	fmt.Fprint(w, "{}")
+}
+
+func newTestRetention(t *testing.T, api *fakeAPI, rules ...Rule) *Retention {
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+	cli := client.NewClient("foobar")
+	cli.BaseURL = server.URL + "/v2/"
+	r := New(cli, rules...)
+	r.now = func() time.Time { return now }
+	return r
+}
+
+func push(iden, typ, device string, age float64, dismissed bool) client.Push {
+	return client.Push{Iden: iden, Type: typ, TargetDeviceIden: device, Dismissed: dismissed,
+		Created: float64(now.Unix()) - age*day, Active: true}
+}
+
+func idens(report Report) string {
+	var idens []string
+	for _, d := range report.Deletions {
+		idens = append(idens, d.Push.Iden)
+	}
+	sort.Strings(idens)
+	return strings.Join(idens, ",")
+}
+
+func TestPlan(t *testing.T) {
+	api := &fakeAPI{pushes: []client.Push{
+		push("link-old-dismissed", "link", "", 40, true),
+		push("link-old", "link", "", 40, false),
+		push("link-new-dismissed", "link", "", 10, true),
+		push("file-a1", "file", "a", 1, false),
+		push("file-a2", "file", "a", 2, false),
+		push("file-a3", "file", "a", 3, false),
+		push("file-b1", "file", "b", 1, false),
+		push("note", "note", "", 100, false),
+	}}
+	tests := []struct {
+		rules []Rule
+		want  string
+	}{
+		{[]Rule{{Type: "link", Dismissed: true, OlderThan: 30 * day * time.Second}}, "link-old-dismissed"},
+		{[]Rule{{Type: "file", KeepLast: 2, PerDevice: true}}, "file-a3"},
+		{[]Rule{{Type: "file", KeepLast: 2}}, "file-a2,file-a3"},
+		{[]Rule{{Type: "file", KeepLast: 1, OlderThan: 2*day*time.Second + time.Hour}}, "file-a3"},
+		{[]Rule{{Device: "b", OlderThan: time.Hour}}, "file-b1"},
+		{[]Rule{{OlderThan: 30 * day * time.Second}, {Type: "link", Dismissed: true, OlderThan: time.Hour}},
+			"link-new-dismissed,link-old,link-old-dismissed,note"},
+	}
+	for _, test := range tests {
+		report, err := newTestRetention(t, api, test.rules...).Plan(context.Background())
+		if err != nil {
+			t.Fatalf("Expected no error, got %#v", err)
+		}
+		if got := idens(report); got != test.want {
+			t.Errorf("Rules %#v: expected %s, got %s", test.rules, test.want, got)
+		}
+		if report.Scanned != len(api.pushes) {
+			t.Errorf("Expected %d scanned, got %d", len(api.pushes), report.Scanned)
+		}
+	}
+	if len(api.deleted) != 0 {
+		t.Errorf("Expected Plan not to delete, got %#v", api.deleted)
+	}
+}
+
+func TestApply(t *testing.T) {
+	api := &fakeAPI{pushes: []client.Push{
+		push("a", "note", "", 40, false),
+		push("fail", "note", "", 40, false),
+		push("b", "note", "", 1, false),
+	}}
+	r := newTestRetention(t, api, Rule{Name: "old notes", OlderThan: 30 * day * time.Second})
+	report, err := r.Apply(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %#v", err)
+	}
+	if report.Deleted() != 1 || report.Err() == nil || report.ByRule()["old notes"] != 2 {
+		t.Errorf("Unexpected report %#v", report)
+	}
+	if len(api.deleted) != 1 || api.deleted[0] != "a" {
+		t.Errorf("Expected a to be deleted, got %#v", api.deleted)
+	}
+}
+
+func TestApplyRateLimit(t *testing.T) {
+	api := &fakeAPI{
+		pushes: []client.Push{push("a", "note", "", 40, false), push("b", "note", "", 40, false)},
+		headers: map[string]string{
+			"X-Ratelimit-Remaining": "10",
+			"X-Ratelimit-Reset":     fmt.Sprint(time.Now().Unix() + 3600),
+		},
+	}
+	r := newTestRetention(t, api, Rule{OlderThan: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := r.Apply(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected deletion to wait for the rate limit, got %#v", err)
+	}
+	if len(api.deleted) != 0 {
+		t.Errorf("Expected no deletion while rate limited, got %#v", api.deleted)
+	}
+}
@@ -0,0 +1,234 @@
+// Package rpc lets agents call each other through Pushbullet, without
+// inbound networking.
+//
+// Every agent is a device of the same account, set up with EnsureDevice.
+// Requests and responses are ephemerals addressed to a target_device_iden
+// and correlated by id; an agent that is not listening when a request is
+// sent never sees it, and the call times out.
+//
+// Usage:
+//
+//	cli.EnsureDevice(ctx, "build-7", "system", "agent")
+//	agent := rpc.New(cli)
+//	rpc.Handle(agent, "restart", func(ctx context.Context, req RestartRequest) (RestartResult, error) {
+//		...
+//	})
+//	go agent.Run(ctx)
+//
+//	var result RestartResult
+//	err := agent.Call(ctx, "build-3", "restart", RestartRequest{Service: "nginx"}, &result)
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+// DefaultTimeout bounds calls when ctx has no deadline.
+const DefaultTimeout = 30 * time.Second
+
+// Type of the ephemerals carrying requests and responses.
+const pushType = "rpc"
+
+var noDeviceError = errors.New("No device, EnsureDevice was not called")
+
+// Error is an error returned by the handler of the remote agent.
+type Error struct {
+	Method  string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Method + ": " + e.Message
+}
+
+// Handler serves a method. params is the JSON of the request parameters,
+// and the result is sent back encoded as JSON.
+type Handler func(ctx context.Context, params json.RawMessage) (any, error)
+
+// A request or response, as the push of an ephemeral.
+type message struct {
+	Type             string          `json:"type"`
+	ID               string          `json:"id"`
+	Method           string          `json:"method"`
+	Response         bool            `json:"response,omitempty"`
+	Params           json.RawMessage `json:"params,omitempty"`
+	Result           json.RawMessage `json:"result,omitempty"`
+	Error            string          `json:"error,omitempty"`
+	SourceDeviceIden string          `json:"source_device_iden"`
+	TargetDeviceIden string          `json:"target_device_iden"`
+}
+
+// Agent serves requests addressed to the device of its client and calls
+// other agents.
+type Agent struct {
+	// Timeout of calls when ctx has no deadline, DefaultTimeout if zero.
+	Timeout time.Duration
+	// OnRequest, if set, is called after every request served, with the
+	// error of the handler or of sending the response.
+	OnRequest func(from, method string, err error)
+
+	client   *client.Client
+	mu       sync.Mutex
+	handlers map[string]Handler
+	pending  map[string]chan message
+}
+
+// New returns an agent for the device set up by EnsureDevice on c.
+func New(c *client.Client) *Agent {
+	return &Agent{client: c, handlers: map[string]Handler{}, pending: map[string]chan message{}}
+}
+
+// HandleFunc registers the handler of method, replacing any previous one.
+func (a *Agent) HandleFunc(method string, handler Handler) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.handlers[method] = handler
+}
+
+// Handle registers a typed handler of method: parameters are decoded into
+// P and the result R is encoded as JSON.
+func Handle[P, R any](a *Agent, method string, fn func(ctx context.Context, params P) (R, error)) {
+	a.HandleFunc(method, func(ctx context.Context, raw json.RawMessage) (any, error) {
+		var params P
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &params); err != nil {
+				return nil, err
+			}
+		}
+		return fn(ctx, params)
+	})
+}
+
+// Run listens to the stream, serving requests and receiving the responses
+// of calls, until ctx is done or the stream rejects the access token.
+// Handlers run concurrently, with ctx.
+func (a *Agent) Run(ctx context.Context) error {
+	if a.client.DeviceIden() == "" {
+		return noDeviceError
+	}
+	return a.client.Stream(ctx, func(msg client.StreamMessage) {
+		if msg.Type != "push" {
+			return
+		}
+		var m message
+		if err := json.Unmarshal(msg.Push, &m); err != nil || m.Type != pushType {
+			return
+		}
+		if m.TargetDeviceIden != a.client.DeviceIden() {
+			return
+		}
+		if m.Response {
+			a.mu.Lock()
+			pending, ok := a.pending[m.ID]
+			a.mu.Unlock()
+			if ok {
+				select {
+				case pending <- m:
+				default:
+				}
+			}
+			return
+		}
+		go a.serve(ctx, m)
+	})
+}
+
+// Call calls method on the agent of device, an iden or a name resolved by
+// the Resolver of the client, and decodes the result into result unless it
+// is nil. Run must be running to receive the response. Errors of the remote
+// handler are returned as *Error.
+func (a *Agent) Call(ctx context.Context, device, method string, params, result any) error {
+	if a.client.DeviceIden() == "" {
+		return noDeviceError
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		timeout := a.Timeout
+		if timeout == 0 {
+			timeout = DefaultTimeout
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	target, err := a.client.Resolver().Device(ctx, device)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	id := client.NewGUID()
+	response := make(chan message, 1)
+	a.mu.Lock()
+	a.pending[id] = response
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		delete(a.pending, id)
+		a.mu.Unlock()
+	}()
+
+	req := message{Type: pushType, ID: id, Method: method, Params: raw, TargetDeviceIden: target.Iden}
+	if err := a.send(ctx, req); err != nil {
+		return err
+	}
+	select {
+	case m := <-response:
+		if m.Error != "" {
+			return &Error{Method: method, Message: m.Error}
+		}
+		if result == nil || len(m.Result) == 0 {
+			return nil
+		}
+		return json.Unmarshal(m.Result, result)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Runs the handler of a request and sends back its response.
+func (a *Agent) serve(ctx context.Context, req message) {
+	a.mu.Lock()
+	handler, ok := a.handlers[req.Method]
+	a.mu.Unlock()
+	resp := message{Type: pushType, ID: req.ID, Method: req.Method, Response: true, TargetDeviceIden: req.SourceDeviceIden}
+	var err error
+	if !ok {
+		err = errors.New("Unknown method")
+	} else {
+		var result any
+		if result, err = handler(ctx, req.Params); err == nil {
+			resp.Result, err = json.Marshal(result)
+		}
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	if sendErr := a.send(ctx, resp); sendErr != nil {
+		err = sendErr
+	}
+	if a.OnRequest != nil {
+		a.OnRequest(req.SourceDeviceIden, req.Method, err)
+	}
+}
+
+func (a *Agent) send(ctx context.Context, m message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	var push client.Params
+	if err := json.Unmarshal(data, &push); err != nil {
+		return err
+	}
+	delete(push, "source_device_iden")
+	return a.client.PushEphemeral(ctx, push)
+}
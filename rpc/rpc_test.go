@@ -0,0 +1,103 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+	"github.com/lucasweiblen/pushbulletclient/pbtest"
+)
+
+type restartRequest struct {
+	Service string `json:"service"`
+}
+
+type restartResult struct {
+	Restarted string `json:"restarted"`
+}
+
+// Starts an agent registered as the device nickname.
+func startAgent(t *testing.T, ctx context.Context, server *pbtest.Server, nickname string) *Agent {
+	cli := server.Client()
+	cli.DeviceFile = filepath.Join(t.TempDir(), "device.json")
+	if _, err := cli.EnsureDevice(ctx, nickname, "system", "agent"); err != nil {
+		t.Fatal(err)
+	}
+	agent := New(cli)
+	agent.Timeout = 5 * time.Second
+	go agent.Run(ctx)
+	return agent
+}
+
+func TestCall(t *testing.T) {
+	server := pbtest.NewServer()
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	caller := startAgent(t, ctx, server, "build-3")
+	callee := startAgent(t, ctx, server, "build-7")
+	Handle(callee, "restart", func(ctx context.Context, req restartRequest) (restartResult, error) {
+		if req.Service == "" {
+			return restartResult{}, errors.New("No service")
+		}
+		return restartResult{Restarted: req.Service}, nil
+	})
+	served := make(chan string, 2)
+	callee.OnRequest = func(from, method string, err error) {
+		served <- method
+	}
+	if !server.WaitStreams(2, 5*time.Second) {
+		t.Fatal("Expected the agents to connect")
+	}
+
+	var result restartResult
+	if err := caller.Call(ctx, "build-7", "restart", restartRequest{Service: "nginx"}, &result); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Restarted != "nginx" {
+		t.Errorf("Unexpected result %#v", result)
+	}
+
+	err := caller.Call(ctx, "build-7", "restart", restartRequest{}, nil)
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Message != "No service" {
+		t.Errorf("Expected remote error, got %v", err)
+	}
+	err = caller.Call(ctx, "build-7", "reboot", nil, nil)
+	if !errors.As(err, &rpcErr) || !strings.Contains(rpcErr.Message, "Unknown method") {
+		t.Errorf("Expected unknown method, got %v", err)
+	}
+	if m := <-served; m != "restart" {
+		t.Errorf("Expected OnRequest for restart, got %s", m)
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	server := pbtest.NewServer()
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	caller := startAgent(t, ctx, server, "build-3")
+	// A device without a running agent.
+	server.AddDevice(client.Device{Iden: "offline", Active: true, Nickname: "build-9"})
+	caller.Timeout = 200 * time.Millisecond
+	err := caller.Call(ctx, "offline", "restart", nil, nil)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestNoDevice(t *testing.T) {
+	server := pbtest.NewServer()
+	defer server.Close()
+	agent := New(server.Client())
+	if err := agent.Run(context.Background()); err != noDeviceError {
+		t.Errorf("Expected noDeviceError, got %v", err)
+	}
+}
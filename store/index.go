@@ -0,0 +1,89 @@
+package store
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+// index maps lower case words to the idens of the pushes containing them.
+type index map[string]map[string]bool
+
+func (idx index) add(push client.Push) {
+	for _, word := range pushWords(push) {
+		idens, ok := idx[word]
+		if !ok {
+			idens = map[string]bool{}
+			idx[word] = idens
+		}
+		idens[push.Iden] = true
+	}
+}
+
+func (idx index) remove(push client.Push) {
+	for _, word := range pushWords(push) {
+		delete(idx[word], push.Iden)
+		if len(idx[word]) == 0 {
+			delete(idx, word)
+		}
+	}
+}
+
+// Returns the idens of the pushes containing every word of text. Terms
+// are split into words like pushes, so "foo-bar" needs both "foo" and
+// "bar". The last word of a term ending in * matches as a prefix.
+func (idx index) search(text string) map[string]bool {
+	var result map[string]bool
+	for _, term := range strings.Fields(strings.ToLower(text)) {
+		term, prefix := strings.CutSuffix(term, "*")
+		termWords := words(term)
+		for i, word := range termWords {
+			matches := idx.lookup(word, prefix && i == len(termWords)-1)
+			if result == nil {
+				result = matches
+				continue
+			}
+			for iden := range result {
+				if !matches[iden] {
+					delete(result, iden)
+				}
+			}
+		}
+	}
+	if result == nil {
+		return map[string]bool{}
+	}
+	return result
+}
+
+// Returns the idens of the pushes containing word, or a word starting with
+// it if prefix is set.
+func (idx index) lookup(word string, prefix bool) map[string]bool {
+	matches := map[string]bool{}
+	if !prefix {
+		for iden := range idx[word] {
+			matches[iden] = true
+		}
+		return matches
+	}
+	for indexed, idens := range idx {
+		if strings.HasPrefix(indexed, word) {
+			for iden := range idens {
+				matches[iden] = true
+			}
+		}
+	}
+	return matches
+}
+
+func pushWords(push client.Push) []string {
+	return words(push.Title + " " + push.Body + " " + push.Url)
+}
+
+// Splits s into lower case words of letters and digits.
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
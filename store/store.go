@@ -0,0 +1,294 @@
+// Package store keeps a local, incrementally synced copy of the pushes,
+// devices and chats of an account, and answers queries on it offline.
+//
+// The data lives in a single append-only file of JSON records, compacted
+// when it is opened, and is indexed in memory for queries and full-text
+// search.
+//
+// Usage:
+//
+//	db, err := store.Open("pushbullet.db")
+//	if err != nil {
+//		log.Fatalln(err)
+//	}
+//	defer db.Close()
+//	if err := db.Sync(ctx, cli); err != nil {
+//		log.Println(err)
+//	}
+//	pushes := db.Pushes(store.Query{Type: "link", Text: "golang"})
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+// Query selects pushes. Empty fields match everything.
+type Query struct {
+	Type string
+	// Device matches the iden of the source or target device.
+	Device string
+	// Sender matches the iden, email or name of the sender.
+	Sender string
+	// Pushes created in [Since, Until).
+	Since time.Time
+	Until time.Time
+	// Text matches pushes whose title, body or url contain
+	// every word of Text. A word ending in * matches as a prefix.
+	Text string
+	// Limit caps the number of results, newest first.
+	Limit int
+}
+
+// Record of the store file.
+type record struct {
+	// One of push, delete, devices, chats or modified.
+	Kind     string          `json:"kind"`
+	Push     *client.Push    `json:"push,omitempty"`
+	Iden     string          `json:"iden,omitempty"`
+	Devices  []client.Device `json:"devices,omitempty"`
+	Chats    []client.Chat   `json:"chats,omitempty"`
+	Modified float64         `json:"modified,omitempty"`
+}
+
+// Store is a local mirror of an account.
+type Store struct {
+	path string
+
+	mu       sync.RWMutex
+	file     *os.File
+	pushes   map[string]client.Push
+	devices  []client.Device
+	chats    []client.Chat
+	modified float64
+	index    index
+}
+
+// Open opens the store at path, creating it if needed.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, pushes: map[string]client.Push{}, index: index{}}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	s.file = file
+	return s, nil
+}
+
+// Close closes the store file.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// Sync fetches what changed since the last sync: pushes modified after the
+// newest one in the store, including deletions, and the current devices and
+// chats.
+func (s *Store) Sync(ctx context.Context, c *client.Client) error {
+	s.mu.RLock()
+	params := client.Params{}
+	if s.modified > 0 {
+		params["modified_after"] = s.modified
+	} else {
+		params["active"] = true
+	}
+	s.mu.RUnlock()
+
+	pushes, err := c.GetPushes(ctx, params)
+	if err != nil {
+		return err
+	}
+	devices, err := c.GetDevices(ctx)
+	if err != nil {
+		return err
+	}
+	chats, err := c.GetChats(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := bufio.NewWriter(s.file)
+	enc := json.NewEncoder(w)
+	for i := range pushes {
+		push := pushes[i]
+		if push.Active {
+			enc.Encode(record{Kind: "push", Push: &push})
+		} else {
+			enc.Encode(record{Kind: "delete", Iden: push.Iden, Modified: push.Modified})
+		}
+		s.applyPush(push)
+	}
+	enc.Encode(record{Kind: "devices", Devices: devices})
+	enc.Encode(record{Kind: "chats", Chats: chats})
+	s.devices, s.chats = devices, chats
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Push returns the push with iden.
+func (s *Store) Push(iden string) (client.Push, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	push, ok := s.pushes[iden]
+	return push, ok
+}
+
+// Pushes returns the pushes matching q, newest first.
+func (s *Store) Pushes(q Query) []client.Push {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var candidates map[string]bool
+	if q.Text != "" {
+		candidates = s.index.search(q.Text)
+	}
+	var result []client.Push
+	for iden, push := range s.pushes {
+		if candidates != nil && !candidates[iden] {
+			continue
+		}
+		if q.match(push) {
+			result = append(result, push)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created > result[j].Created
+	})
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[:q.Limit]
+	}
+	return result
+}
+
+// Devices returns the devices as of the last sync.
+func (s *Store) Devices() []client.Device {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]client.Device(nil), s.devices...)
+}
+
+// Chats returns the chats as of the last sync.
+func (s *Store) Chats() []client.Chat {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]client.Chat(nil), s.chats...)
+}
+
+func (q Query) match(push client.Push) bool {
+	if q.Type != "" && push.Type != q.Type {
+		return false
+	}
+	if q.Device != "" && push.SourceDeviceIden != q.Device && push.TargetDeviceIden != q.Device {
+		return false
+	}
+	if q.Sender != "" && push.SenderIden != q.Sender && !strings.EqualFold(push.SenderEmail, q.Sender) &&
+		!strings.EqualFold(push.SenderEmailNormalized, q.Sender) && !strings.EqualFold(push.SenderName, q.Sender) {
+		return false
+	}
+	created := client.Time(push.Created)
+	if !q.Since.IsZero() && created.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !created.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+func (s *Store) applyPush(push client.Push) {
+	if push.Modified > s.modified {
+		s.modified = push.Modified
+	}
+	if old, ok := s.pushes[push.Iden]; ok {
+		s.index.remove(old)
+		delete(s.pushes, push.Iden)
+	}
+	if push.Active {
+		s.pushes[push.Iden] = push
+		s.index.add(push)
+	}
+}
+
+func (s *Store) load() error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		switch rec.Kind {
+		case "push":
+			if rec.Push != nil {
+				s.applyPush(*rec.Push)
+			}
+		case "delete":
+			s.applyPush(client.Push{Iden: rec.Iden, Modified: rec.Modified})
+		case "devices":
+			s.devices = rec.Devices
+		case "chats":
+			s.chats = rec.Chats
+		case "modified":
+			if rec.Modified > s.modified {
+				s.modified = rec.Modified
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// Rewrites the store file with only the current records.
+func (s *Store) compact() error {
+	tmp := s.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, push := range s.pushes {
+		enc.Encode(record{Kind: "push", Push: &push})
+	}
+	// Keeps the sync position when the newest change was a deletion.
+	enc.Encode(record{Kind: "modified", Modified: s.modified})
+	enc.Encode(record{Kind: "devices", Devices: s.devices})
+	enc.Encode(record{Kind: "chats", Chats: s.chats})
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
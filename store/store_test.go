@@ -0,0 +1,163 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+const firstSync = `
+{
+  "pushes": [
+  {
+    "iden": "ubdprOsjAhOzf0XYq",
+    "type": "link",
+    "title": "Pushbullet",
+    "body": "Documenting our API",
+    "url": "http://docs.pushbullet.com",
+    "created": 1411595135.9685705,
+    "modified": 1411595135.9686127,
+    "active": true,
+    "sender_iden": "ubd",
+    "sender_email": "ryan@pushbullet.com",
+    "target_device_iden": "udm0Tdjz5A7bL4NM"
+  },
+  {
+    "iden": "ubdpj29aOK0sKG",
+    "type": "note",
+    "title": "Groceries",
+    "body": "Milk and bread",
+    "created": 1399253701.9744401,
+    "modified": 1399253701.9746201,
+    "active": true,
+    "sender_iden": "ujlMns72k",
+    "sender_email": "carmack@idsoftware.com",
+    "sender_name": "John Carmack"
+  }
+  ]
+}
+`
+
+const secondSync = `
+{
+  "pushes": [
+  {
+    "iden": "ubdpj29aOK0sKG",
+    "modified": 1411600000.5,
+    "active": false
+  },
+  {
+    "iden": "ubdpjAkaGXvUl2",
+    "type": "note",
+    "title": "Release notes",
+    "body": "Documentation for the new API",
+    "created": 1411595195.1267679,
+    "modified": 1411595195.1268303,
+    "active": true
+  }
+  ]
+}
+`
+
+func newTestServer(t *testing.T, queries *[]string) *client.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/pushes":
+			*queries = append(*queries, r.URL.RawQuery)
+			if len(*queries) == 1 {
+				fmt.Fprint(w, firstSync)
+			} else {
+				fmt.Fprint(w, secondSync)
+			}
+		case "/v2/devices":
+			fmt.Fprint(w, `{"devices": [{"iden": "udm0Tdjz5A7bL4NM", "nickname": "laptop", "active": true}]}`)
+		case "/v2/chats":
+			fmt.Fprint(w, `{"chats": [{"iden": "ujpah72o0sjAoRtnM0jc", "with": {"email": "carmack@idsoftware.com"}}]}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	cli := client.NewClient("foobar")
+	cli.BaseURL = server.URL + "/v2/"
+	return cli
+}
+
+func TestStoreSync(t *testing.T) {
+	var queries []string
+	cli := newTestServer(t, &queries)
+	path := filepath.Join(t.TempDir(), "pushbullet.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %#v", err)
+	}
+	if err := db.Sync(context.Background(), cli); err != nil {
+		t.Fatalf("Expected no error, got %#v", err)
+	}
+	if len(db.Pushes(Query{})) != 2 || len(db.Devices()) != 1 || len(db.Chats()) != 1 {
+		t.Fatalf("Unexpected store contents %#v %#v %#v", db.Pushes(Query{}), db.Devices(), db.Chats())
+	}
+	if err := db.Sync(context.Background(), cli); err != nil {
+		t.Fatalf("Expected no error, got %#v", err)
+	}
+	if queries[0] != "active=true" || queries[1] != "modified_after=1411595135.9686127" {
+		t.Errorf("Unexpected queries %#v", queries)
+	}
+	if _, ok := db.Push("ubdpj29aOK0sKG"); ok {
+		t.Errorf("Expected deleted push to be removed")
+	}
+	db.Close()
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %#v", err)
+	}
+	defer db.Close()
+	pushes := db.Pushes(Query{})
+	if len(pushes) != 2 || pushes[0].Iden != "ubdpjAkaGXvUl2" || pushes[1].Iden != "ubdprOsjAhOzf0XYq" {
+		t.Errorf("Expected pushes newest first after reopening, got %#v", pushes)
+	}
+	if db.modified != 1411600000.5 {
+		t.Errorf("Expected sync position to survive reopening, got %v", db.modified)
+	}
+}
+
+func TestStoreQuery(t *testing.T) {
+	var queries []string
+	cli := newTestServer(t, &queries)
+	db, _ := Open(filepath.Join(t.TempDir(), "pushbullet.db"))
+	defer db.Close()
+	db.Sync(context.Background(), cli)
+
+	tests := []struct {
+		query Query
+		idens []string
+	}{
+		{Query{Type: "note"}, []string{"ubdpj29aOK0sKG"}},
+		{Query{Device: "udm0Tdjz5A7bL4NM"}, []string{"ubdprOsjAhOzf0XYq"}},
+		{Query{Sender: "John Carmack"}, []string{"ubdpj29aOK0sKG"}},
+		{Query{Sender: "RYAN@pushbullet.com"}, []string{"ubdprOsjAhOzf0XYq"}},
+		{Query{Since: time.Unix(1400000000, 0)}, []string{"ubdprOsjAhOzf0XYq"}},
+		{Query{Until: time.Unix(1400000000, 0)}, []string{"ubdpj29aOK0sKG"}},
+		{Query{Text: "milk"}, []string{"ubdpj29aOK0sKG"}},
+		{Query{Text: "docs.pushbullet.com"}, []string{"ubdprOsjAhOzf0XYq"}},
+		{Query{Text: "document*"}, []string{"ubdprOsjAhOzf0XYq"}},
+		{Query{Text: "milk api"}, nil},
+		{Query{Text: "milk-api"}, nil},
+		{Query{Text: "docs.push*"}, []string{"ubdprOsjAhOzf0XYq"}},
+		{Query{Limit: 1}, []string{"ubdprOsjAhOzf0XYq"}},
+	}
+	for _, test := range tests {
+		var idens []string
+		for _, push := range db.Pushes(test.query) {
+			idens = append(idens, push.Iden)
+		}
+		if fmt.Sprint(idens) != fmt.Sprint(test.idens) {
+			t.Errorf("Query %#v: expected %v, got %v", test.query, test.idens, idens)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package watch
+
+import (
+	"context"
+	"errors"
+)
+
+// File notifications are only implemented with inotify; elsewhere the
+// directory is polled.
+func notify(ctx context.Context, dir string) (<-chan struct{}, error) {
+	return nil, errors.New("watch: file notifications not supported")
+}
@@ -0,0 +1,297 @@
+// Package watch pushes the files dropped into a directory, such as build
+// artifacts or scans.
+//
+// A file is pushed once it has stopped changing, so files still being
+// written are left alone. What was pushed is recorded in a state file, so a
+// restarted watcher does not push the same files again. Changes are picked
+// up with inotify on Linux and by polling elsewhere.
+//
+// Usage:
+//
+//	w, err := watch.New(cli, "/srv/scans", "/var/lib/scans.json", client.Params{"device_iden": "ujpah72o0"})
+//	if err != nil {
+//		log.Fatalln(err)
+//	}
+//	err = w.Run(ctx)
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+// Defaults of a Watcher.
+const (
+	DefaultSettle   = 2 * time.Second
+	DefaultInterval = 5 * time.Second
+)
+
+// Scan interval when inotify reports changes, to catch anything it missed.
+var notifyInterval = time.Minute
+
+// Sent records a pushed file.
+type Sent struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	// Iden of the push, empty if the push failed permanently.
+	Iden string    `json:"iden,omitempty"`
+	Sent time.Time `json:"sent"`
+	// Error of a push rejected by the API. The file is not retried unless
+	// it changes.
+	Error string `json:"error,omitempty"`
+}
+
+// A file seen by a scan but not pushed yet.
+type observation struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+// Watcher pushes the new files of a directory.
+type Watcher struct {
+	// Params are added to every push, typically the target: device_iden,
+	// email or channel_tag.
+	Params client.Params
+	// Settle is how long a file must keep its size and modification time
+	// before it is pushed.
+	Settle time.Duration
+	// Interval between scans when inotify is not available.
+	Interval time.Duration
+	// OnPush, if set, is called after every attempt to push a file.
+	OnPush func(name string, push client.Push, err error)
+
+	client    *client.Client
+	dir       string
+	statePath string
+	mu        sync.Mutex
+	sent      map[string]Sent
+	seen      map[string]observation
+}
+
+// New returns a Watcher pushing the files of dir, recording them in the
+// state file at statePath.
+func New(c *client.Client, dir, statePath string, params client.Params) (*Watcher, error) {
+	w := &Watcher{
+		Params:    params,
+		Settle:    DefaultSettle,
+		Interval:  DefaultInterval,
+		client:    c,
+		dir:       dir,
+		statePath: statePath,
+		sent:      map[string]Sent{},
+		seen:      map[string]observation{},
+	}
+	data, err := os.ReadFile(statePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &w.sent); err != nil {
+			return nil, fmt.Errorf("watch: reading state: %w", err)
+		}
+	}
+	return w, nil
+}
+
+// Sent returns the pushed files by name.
+func (w *Watcher) Sent() map[string]Sent {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	sent := make(map[string]Sent, len(w.sent))
+	for name, s := range w.sent {
+		sent[name] = s
+	}
+	return sent
+}
+
+// Run scans the directory whenever it changes, until ctx is done or the
+// directory cannot be read.
+func (w *Watcher) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	interval := w.Interval
+	changes, err := notify(ctx, w.dir)
+	if err == nil {
+		interval = notifyInterval
+	}
+	for {
+		if _, err := os.Stat(w.dir); err != nil {
+			return err
+		}
+		// Failed files are reported to OnPush and retried by the next scan.
+		w.Scan(ctx)
+		wait := interval
+		if w.unsettled() && w.Settle < wait {
+			wait = w.Settle
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case _, ok := <-changes:
+			if !ok {
+				changes, interval = nil, w.Interval
+			}
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// Scan pushes the files of the directory that have settled and were not
+// pushed yet. Files failing with a transient error are retried by the next
+// scan and the returned error joins their errors. Files rejected by the API
+// are recorded with their error and not retried unless they change.
+func (w *Watcher) Scan(ctx context.Context) error {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	present := map[string]bool{}
+	var errs []error
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || ignored(name) || filepath.Join(w.dir, name) == w.statePath {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		present[name] = true
+		if !w.ready(name, info, now) {
+			continue
+		}
+		if err := w.push(ctx, name, info); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	w.mu.Lock()
+	for name := range w.seen {
+		if !present[name] {
+			delete(w.seen, name)
+		}
+	}
+	w.mu.Unlock()
+	return errors.Join(errs...)
+}
+
+// Reports whether the file has to be pushed: it was not pushed in this
+// version and has not changed for Settle.
+func (w *Watcher) ready(name string, info os.FileInfo, now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if s, ok := w.sent[name]; ok && s.Size == info.Size() && s.ModTime.Equal(info.ModTime()) {
+		delete(w.seen, name)
+		return false
+	}
+	o, ok := w.seen[name]
+	if !ok || o.size != info.Size() || !o.modTime.Equal(info.ModTime()) {
+		w.seen[name] = observation{size: info.Size(), modTime: info.ModTime(), since: now}
+		return w.Settle <= 0
+	}
+	return now.Sub(o.since) >= w.Settle
+}
+
+func (w *Watcher) unsettled() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.seen) > 0
+}
+
+func (w *Watcher) push(ctx context.Context, name string, info os.FileInfo) error {
+	path := filepath.Join(w.dir, name)
+	filetype, err := fileType(path)
+	if err != nil {
+		return err
+	}
+	var push client.Push
+	fileUrl, err := w.client.PushFile(ctx, name, filetype, path)
+	if err == nil {
+		params := client.Params{}
+		for k, v := range w.Params {
+			params[k] = v
+		}
+		params["type"] = "file"
+		params["file_name"] = name
+		params["file_type"] = filetype
+		params["file_url"] = fileUrl
+		push, err = w.client.CreatePush(ctx, params)
+	}
+	if w.OnPush != nil {
+		w.OnPush(name, push, err)
+	}
+	if err != nil && !client.IsPermanent(err) {
+		return err
+	}
+	s := Sent{Size: info.Size(), ModTime: info.ModTime(), Iden: push.Iden, Sent: time.Now()}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.sent[name] = s
+	delete(w.seen, name)
+	// A rejected file is recorded, not retried.
+	return w.save()
+}
+
+// Writes the state file atomically.
+func (w *Watcher) save() error {
+	data, err := json.MarshalIndent(w.sent, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := w.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.statePath)
+}
+
+// Names of hidden files and of files that are still being written by
+// common tools.
+func ignored(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") {
+		return true
+	}
+	switch filepath.Ext(name) {
+	case ".part", ".partial", ".tmp", ".crdownload", ".swp":
+		return true
+	}
+	return false
+}
+
+// Returns the MIME type of the file at path, from its extension or its
+// first bytes.
+func fileType(path string) (string, error) {
+	if t := mime.TypeByExtension(filepath.Ext(path)); t != "" {
+		t, _, _ = strings.Cut(t, ";")
+		return t, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	buf := make([]byte, 512)
+	n, _ := file.Read(buf)
+	return http.DetectContentType(buf[:n]), nil
+}
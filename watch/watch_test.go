@@ -0,0 +1,149 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lucasweiblen/pushbulletclient/client"
+)
+
+// fakeAccount serves the parts of the API used to push files.
+type fakeAccount struct {
+	mu      sync.Mutex
+	pushes  []client.Params
+	uploads []string
+	// File names rejected by the API.
+	reject string
+}
+
+func (a *fakeAccount) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch r.URL.Path {
+	case "/v2/upload-request":
+		fmt.Fprintf(w, `{"file_url": "http://%s/files/uploaded", "upload_url": "http://%s/upload"}`, r.Host, r.Host)
+	case "/upload":
+		r.ParseMultipartForm(1 << 20)
+		file, _, _ := r.FormFile("file")
+		data, _ := io.ReadAll(file)
+		a.uploads = append(a.uploads, string(data))
+		w.WriteHeader(http.StatusNoContent)
+	case "/v2/pushes":
+		var params client.Params
+		json.NewDecoder(r.Body).Decode(&params)
+		if params["file_name"] == a.reject {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": {"type": "invalid_request", "message": "File too big"}}`)
+			return
+		}
+		a.pushes = append(a.pushes, params)
+		fmt.Fprintf(w, `{"iden": "push%d"}`, len(a.pushes))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (a *fakeAccount) pushed() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.pushes)
+}
+
+func newTestClient(t *testing.T, account *fakeAccount) *client.Client {
+	server := httptest.NewServer(account)
+	t.Cleanup(server.Close)
+	cli := client.NewClient("foobar")
+	cli.BaseURL = server.URL + "/v2/"
+	return cli
+}
+
+func TestScan(t *testing.T) {
+	account := &fakeAccount{reject: "big.iso"}
+	cli := newTestClient(t, account)
+	dir := t.TempDir()
+	state := filepath.Join(dir, ".state.json")
+	os.WriteFile(filepath.Join(dir, "scan.pdf"), []byte("%PDF-1.4"), 0600)
+	os.WriteFile(filepath.Join(dir, "big.iso"), []byte("iso"), 0600)
+	os.WriteFile(filepath.Join(dir, "build.zip.part"), []byte("partial"), 0600)
+	w, err := New(cli, dir, state, client.Params{"channel_tag": "builds"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Settle = 20 * time.Millisecond
+	ctx := context.Background()
+
+	// Files are only pushed once they have settled.
+	w.Scan(ctx)
+	if account.pushed() != 0 {
+		t.Fatalf("Expected no pushes before files settle, got %d", account.pushed())
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := w.Scan(ctx); err != nil {
+		t.Errorf("Expected rejected files not to be an error, got %v", err)
+	}
+	if account.pushed() != 1 {
+		t.Fatalf("Expected 1 push, got %d", account.pushed())
+	}
+	push := account.pushes[0]
+	if push["file_name"] != "scan.pdf" || push["file_type"] != "application/pdf" || push["channel_tag"] != "builds" {
+		t.Errorf("Unexpected push %#v", push)
+	}
+	if sent := w.Sent(); sent["scan.pdf"].Iden != "push1" || sent["big.iso"].Error == "" {
+		t.Errorf("Unexpected state %#v", sent)
+	}
+
+	// A restarted watcher does not push the same files again.
+	w, err = New(cli, dir, state, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Settle = 0
+	w.Scan(ctx)
+	if account.pushed() != 1 {
+		t.Errorf("Expected no new pushes after a restart, got %d", account.pushed())
+	}
+	os.WriteFile(filepath.Join(dir, "scan.pdf"), []byte("%PDF-1.4 changed"), 0600)
+	w.Scan(ctx)
+	if account.pushed() != 2 {
+		t.Errorf("Expected a changed file to be pushed again, got %d pushes", account.pushed())
+	}
+}
+
+func TestRun(t *testing.T) {
+	account := &fakeAccount{}
+	cli := newTestClient(t, account)
+	dir := t.TempDir()
+	w, err := New(cli, dir, filepath.Join(t.TempDir(), "state.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Settle = 10 * time.Millisecond
+	w.Interval = 10 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- w.Run(ctx)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	os.WriteFile(filepath.Join(dir, "artifact.tar.gz"), []byte("artifact"), 0600)
+	for account.pushed() == 0 && ctx.Err() == nil {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if account.pushed() != 1 || account.uploads[0] != "artifact" {
+		t.Errorf("Expected artifact to be pushed, got %d pushes", account.pushed())
+	}
+}